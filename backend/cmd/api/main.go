@@ -2,282 +2,92 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
+	"log/slog"
 	"os"
-	"strings"
-	"sync"
-	"time"
 
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/websocket/v2"
+	"github.com/matthewhu/sportarbitrage/internal/api"
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
 	"github.com/matthewhu/sportarbitrage/internal/kafka"
-	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/startup"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+	"github.com/matthewhu/sportarbitrage/internal/telemetry"
 	"github.com/redis/go-redis/v9"
 )
 
-type Server struct {
-	app       *fiber.App
-	consumer  *kafka.Consumer
-	redis     *redis.Client
-	ctx       context.Context
-	clients   map[*websocket.Conn]bool
-	broadcast chan models.ArbitrageOpportunity
-	mu        sync.RWMutex
-}
-
-func NewServer() *Server {
-	app := fiber.New()
-
-	// Configure CORS
-	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept",
-	}))
-
-	// Add logger
-	app.Use(logger.New())
-
-	// Get Kafka brokers from environment
-	brokers := strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
-	if len(brokers) == 0 || brokers[0] == "" {
-		brokers = []string{"localhost:9092"}
-	}
-
-	// Create Kafka consumer for arbitrage events
-	consumer := kafka.NewConsumer(brokers, "arbitrage-found", "websocket-group")
-
-	// Create Redis client
-	redisURL := os.Getenv("REDIS_URL")
-	if redisURL == "" {
-		redisURL = "localhost:6379"
+func main() {
+	cfg, err := config.Load("api", os.Args[1:])
+	if errors.Is(err, config.ErrPrintedConfig) {
+		os.Exit(0)
 	}
-
-	rdb := redis.NewClient(&redis.Options{
-		Addr: redisURL,
-	})
-
-	server := &Server{
-		app:       app,
-		consumer:  consumer,
-		redis:     rdb,
-		ctx:       context.Background(),
-		clients:   make(map[*websocket.Conn]bool),
-		broadcast: make(chan models.ArbitrageOpportunity, 100),
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	server.setupRoutes()
-	return server
-}
-
-func (s *Server) setupRoutes() {
-	// Health check
-	s.app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"status": "healthy",
-			"time":   time.Now(),
-		})
-	})
-
-	// Get active arbitrage opportunities
-	s.app.Get("/api/arbitrage", func(c *fiber.Ctx) error {
-		opportunities := s.getActiveArbitrage()
-		return c.JSON(opportunities)
-	})
-
-	// Get current odds for an event
-	s.app.Get("/api/odds/:eventId", func(c *fiber.Ctx) error {
-		eventID := c.Params("eventId")
-		odds := s.getEventOdds(eventID)
-		return c.JSON(odds)
-	})
-
-	// WebSocket endpoint
-	s.app.Get("/ws", websocket.New(func(c *websocket.Conn) {
-		s.handleWebSocket(c)
-	}))
-
-	// Static file serving for frontend
-	s.app.Static("/", "./frontend/build")
-}
-
-func (s *Server) handleWebSocket(conn *websocket.Conn) {
-	// Register client
-	s.mu.Lock()
-	s.clients[conn] = true
-	s.mu.Unlock()
-
-	log.Printf("WebSocket client connected. Total clients: %d", len(s.clients))
-
-	// Send current active arbitrage opportunities
-	opportunities := s.getActiveArbitrage()
-	for _, arb := range opportunities {
-		msg := models.WebSocketMessage{
-			Type:      "arbitrage",
-			Data:      arb,
-			Timestamp: time.Now(),
-		}
-		conn.WriteJSON(msg)
+	// Structured logs; the level can be changed at /admin/log-level
+	if err := telemetry.SetupLogging(telemetry.LoggingOptionsFrom(cfg.Logging), "api", bus.Instance()); err != nil {
+		log.Fatal(err)
 	}
+	slog.Info("Effective config", "config", cfg)
 
-	// Keep connection alive and handle messages
-	defer func() {
-		s.mu.Lock()
-		delete(s.clients, conn)
-		s.mu.Unlock()
-		conn.Close()
-		log.Printf("WebSocket client disconnected. Total clients: %d", len(s.clients))
-	}()
+	ctx, stop := startup.SignalContext()
+	defer stop()
+	// Bounds everything left to do once ctx is cancelled
+	drain := startup.DrainContext(ctx, cfg.HTTP.ShutdownTimeout.Duration)
 
-	for {
-		messageType, _, err := conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
-			}
-			break
-		}
-
-		// Send pong for ping messages
-		if messageType == websocket.PingMessage {
-			conn.WriteMessage(websocket.PongMessage, []byte{})
-		}
+	// Export spans; the pipeline is traced end to end through message headers
+	shutdownTracing, err := telemetry.SetupTracing(ctx, telemetry.TracingOptionsFrom(cfg.Tracing), "api", bus.Instance())
+	if err != nil {
+		telemetry.Fatal("Error setting up tracing", "error", err)
 	}
-}
 
-func (s *Server) broadcastToClients() {
-	for arb := range s.broadcast {
-		msg := models.WebSocketMessage{
-			Type:      "arbitrage",
-			Data:      arb,
-			Timestamp: time.Now(),
-		}
-
-		s.mu.RLock()
-		for client := range s.clients {
-			err := client.WriteJSON(msg)
-			if err != nil {
-				log.Printf("Error broadcasting to client: %v", err)
-				client.Close()
-			}
-		}
-		s.mu.RUnlock()
-	}
-}
-
-func (s *Server) consumeArbitrageEvents() {
-	log.Println("Starting Kafka consumer for arbitrage events")
-
-	for {
-		msg, err := s.consumer.ReadMessage(s.ctx)
-		if err != nil {
-			log.Printf("Error reading Kafka message: %v", err)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-
-		var arb models.ArbitrageOpportunity
-		if err := json.Unmarshal(msg.Value, &arb); err != nil {
-			log.Printf("Error parsing arbitrage message: %v", err)
-			continue
-		}
-
-		log.Printf("Received arbitrage from Kafka: %s vs %s (%.2f%%)",
-			arb.HomeTeam, arb.AwayTeam, arb.ProfitPercent)
-
-		// Send to broadcast channel for real-time WebSocket push
-		select {
-		case s.broadcast <- arb:
-		default:
-			log.Println("Broadcast channel full, dropping message")
-		}
+	// Create Kafka bus and Redis client
+	codecs, err := kafka.NewCodecs(cfg.Kafka.Encoding, cfg.Kafka.SchemaDir)
+	if err != nil {
+		telemetry.Fatal("Error loading schemas", "error", err)
 	}
-}
-
-func (s *Server) getActiveArbitrage() []models.ArbitrageOpportunity {
-	var opportunities []models.ArbitrageOpportunity
+	b := kafka.NewBus(cfg.Kafka.Brokers, kafka.ConsumerOptionsFrom(cfg.Kafka.Consumer), codecs)
+	rdb := redis.NewClient(&redis.Options{
+		Addr: cfg.Redis.Addr,
+	})
+	rdb.AddHook(metrics.RedisHook{})
 
-	// Get active arbitrage IDs from Redis
-	ids, err := s.redis.SMembers(s.ctx, "active_arbitrage").Result()
+	// Connect to Postgres for the event catalogue
+	db, err := storage.OpenPostgres(cfg.Postgres.URL)
 	if err != nil {
-		log.Printf("Error getting active arbitrage: %v", err)
-		return opportunities
+		telemetry.Fatal("Error opening Postgres", "error", err)
 	}
 
-	for _, id := range ids {
-		key := fmt.Sprintf("arbitrage:%s", id)
-		data, err := s.redis.Get(s.ctx, key).Result()
-		if err != nil {
-			continue
+	server := api.NewServer(cfg, b, storage.NewRedisOpportunityStore(rdb), storage.NewRedisOddsStore(rdb, cfg.Redis.OddsTTL.Duration),
+		storage.NewEventRepository(db))
+	server.Run(ctx,
+		startup.Kafka(cfg.Kafka.Brokers, cfg.Kafka.Topics.ArbitrageFound, bus.DeadLetterTopic(cfg.Kafka.Topics.ArbitrageFound)),
+		startup.Redis(rdb),
+		startup.Postgres(db),
+		// The API only reads; the writers migrate the schema
+		startup.Check{Name: "postgres schema", Probe: func(ctx context.Context) error {
+			return storage.CheckSchema(ctx, db)
+		}},
+	)
+
+	stop()
+	err = startup.Shutdown(drain, func(ctx context.Context) {
+		defer shutdownTracing(ctx)
+		server.Close(ctx)
+		if err := b.Close(); err != nil {
+			slog.Error("Error closing bus", "error", err)
 		}
-
-		var arb models.ArbitrageOpportunity
-		if err := json.Unmarshal([]byte(data), &arb); err != nil {
-			continue
+		if err := rdb.Close(); err != nil {
+			slog.Error("Error closing Redis", "error", err)
 		}
-
-		// Check if not expired
-		if time.Now().Before(arb.ExpiresAt) {
-			opportunities = append(opportunities, arb)
+		if err := db.Close(); err != nil {
+			slog.Error("Error closing Postgres", "error", err)
 		}
-	}
-
-	return opportunities
-}
-
-func (s *Server) getEventOdds(eventID string) []models.OddsUpdate {
-	var odds []models.OddsUpdate
-
-	// Get all odds for this event from Redis
-	pattern := fmt.Sprintf("odds:%s:*", eventID)
-	keys, err := s.redis.Keys(s.ctx, pattern).Result()
+	})
 	if err != nil {
-		return odds
-	}
-
-	for _, key := range keys {
-		data, err := s.redis.Get(s.ctx, key).Result()
-		if err != nil {
-			continue
-		}
-
-		var odd models.OddsUpdate
-		if err := json.Unmarshal([]byte(data), &odd); err != nil {
-			continue
-		}
-
-		odds = append(odds, odd)
+		telemetry.Fatal("Shutdown failed", "error", err)
 	}
-
-	return odds
 }
-
-func (s *Server) Run() {
-	// Start Kafka consumer in background
-	go s.consumeArbitrageEvents()
-
-	// Start WebSocket broadcaster
-	go s.broadcastToClients()
-
-	// Start HTTP server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	log.Printf("Starting API server on port %s", port)
-	if err := s.app.Listen(":" + port); err != nil {
-		log.Fatal(err)
-	}
-}
-
-func main() {
-	// Wait for services to be ready
-	time.Sleep(20 * time.Second)
-
-	server := NewServer()
-	server.Run()
-}
\ No newline at end of file
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/catalogue"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/events"
+	"github.com/matthewhu/sportarbitrage/internal/kafka"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/startup"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+	"github.com/matthewhu/sportarbitrage/internal/telemetry"
+)
+
+func main() {
+	cfg, err := config.Load("catalogue", os.Args[1:])
+	if errors.Is(err, config.ErrPrintedConfig) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Structured logs; the level can be changed at /admin/log-level
+	if err := telemetry.SetupLogging(telemetry.LoggingOptionsFrom(cfg.Logging), "catalogue", bus.Instance()); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("Effective config", "config", cfg)
+
+	ctx, stop := startup.SignalContext()
+	defer stop()
+	// Bounds everything left to do once ctx is cancelled
+	drain := startup.DrainContext(ctx, cfg.HTTP.ShutdownTimeout.Duration)
+
+	// Export spans; the pipeline is traced end to end through message headers
+	shutdownTracing, err := telemetry.SetupTracing(ctx, telemetry.TracingOptionsFrom(cfg.Tracing), "catalogue", bus.Instance())
+	if err != nil {
+		telemetry.Fatal("Error setting up tracing", "error", err)
+	}
+
+	// Create Kafka bus for lifecycle messages
+	codecs, err := kafka.NewCodecs(cfg.Kafka.Encoding, cfg.Kafka.SchemaDir)
+	if err != nil {
+		telemetry.Fatal("Error loading schemas", "error", err)
+	}
+	b := kafka.NewBus(cfg.Kafka.Brokers, kafka.ConsumerOptionsFrom(cfg.Kafka.Consumer), codecs)
+
+	// Connect to Postgres
+	db, err := storage.OpenPostgres(cfg.Postgres.URL)
+	if err != nil {
+		telemetry.Fatal("Error opening Postgres", "error", err)
+	}
+
+	// Read the schedule from a file if one is configured, otherwise simulate it
+	var provider events.Provider = events.NewSimulatedProvider()
+	if path := cfg.Catalogue.ScheduleFile; path != "" {
+		provider, err = events.NewFileProvider(path)
+		if err != nil {
+			telemetry.Fatal("Error loading schedule", "error", err)
+		}
+	}
+
+	c := catalogue.NewCatalogue(cfg, provider, b, storage.NewEventRepository(db))
+
+	// Serve /ready and /metrics straight away so it reports while we wait on dependencies
+	readiness := startup.NewReadiness("catalogue")
+	mux := http.NewServeMux()
+	readiness.Register(mux)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/admin/log-level", telemetry.LevelHandler())
+	startup.ListenAndServe(":"+cfg.HTTP.HealthPort, mux)
+
+	err = readiness.WaitFor(ctx, startup.BackoffFrom(cfg.Startup),
+		startup.Kafka(cfg.Kafka.Brokers, cfg.Kafka.Topics.EventLifecycle),
+		startup.Postgres(db),
+	)
+	if err != nil {
+		telemetry.Fatal("Dependencies not ready", "error", err)
+	}
+	if err := storage.Migrate(ctx, db); err != nil {
+		telemetry.Fatal("Error migrating the database schema", "error", err)
+	}
+
+	c.Run(ctx)
+
+	stop()
+	err = startup.Shutdown(drain, func(ctx context.Context) {
+		defer shutdownTracing(ctx)
+		if err := b.Close(); err != nil {
+			slog.Error("Error flushing producers", "error", err)
+		}
+		if err := db.Close(); err != nil {
+			slog.Error("Error closing Postgres", "error", err)
+		}
+	})
+	if err != nil {
+		telemetry.Fatal("Shutdown failed", "error", err)
+	}
+}
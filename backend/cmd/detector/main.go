@@ -2,160 +2,96 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
-	"strings"
-	"sync"
-	"time"
 
-	"github.com/matthewhu/sportarbitrage/internal/arbitrage"
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/detector"
 	"github.com/matthewhu/sportarbitrage/internal/kafka"
-	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/startup"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+	"github.com/matthewhu/sportarbitrage/internal/telemetry"
 	"github.com/redis/go-redis/v9"
 )
 
-type Detector struct {
-	consumer   *kafka.Consumer
-	producer   *kafka.Producer
-	redis      *redis.Client
-	calculator *arbitrage.Calculator
-	ctx        context.Context
-	oddsCache  map[string]*models.OddsUpdate
-	mu         sync.RWMutex
-}
+func main() {
+	cfg, err := config.Load("detector", os.Args[1:])
+	if errors.Is(err, config.ErrPrintedConfig) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 
-func NewDetector() *Detector {
-	// Get Kafka brokers from environment
-	brokers := strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
-	if len(brokers) == 0 || brokers[0] == "" {
-		brokers = []string{"localhost:9092"}
+	// Structured logs; the level can be changed at /admin/log-level
+	if err := telemetry.SetupLogging(telemetry.LoggingOptionsFrom(cfg.Logging), "detector", bus.Instance()); err != nil {
+		log.Fatal(err)
 	}
+	slog.Info("Effective config", "config", cfg)
 
-	// Create Kafka consumer and producer
-	consumer := kafka.NewConsumer(brokers, "odds-updates", "detector-group")
-	producer := kafka.NewProducer(brokers, "arbitrage-found")
+	ctx, stop := startup.SignalContext()
+	defer stop()
+	// Bounds everything left to do once ctx is cancelled
+	drain := startup.DrainContext(ctx, cfg.HTTP.ShutdownTimeout.Duration)
 
-	// Create Redis client
-	redisURL := os.Getenv("REDIS_URL")
-	if redisURL == "" {
-		redisURL = "localhost:6379"
+	// Export spans; the pipeline is traced end to end through message headers
+	shutdownTracing, err := telemetry.SetupTracing(ctx, telemetry.TracingOptionsFrom(cfg.Tracing), "detector", bus.Instance())
+	if err != nil {
+		telemetry.Fatal("Error setting up tracing", "error", err)
 	}
 
+	// Create Kafka bus and Redis client
+	codecs, err := kafka.NewCodecs(cfg.Kafka.Encoding, cfg.Kafka.SchemaDir)
+	if err != nil {
+		telemetry.Fatal("Error loading schemas", "error", err)
+	}
+	b := kafka.NewBus(cfg.Kafka.Brokers, kafka.ConsumerOptionsFrom(cfg.Kafka.Consumer), codecs)
 	rdb := redis.NewClient(&redis.Options{
-		Addr: redisURL,
+		Addr: cfg.Redis.Addr,
 	})
-
-	// Create arbitrage calculator with 0.5% minimum profit
-	calc := arbitrage.NewCalculator(0.5)
-
-	return &Detector{
-		consumer:   consumer,
-		producer:   producer,
-		redis:      rdb,
-		calculator: calc,
-		ctx:        context.Background(),
-		oddsCache:  make(map[string]*models.OddsUpdate),
+	rdb.AddHook(metrics.RedisHook{})
+
+	d := detector.NewDetector(cfg, b, storage.NewRedisDetectorStateStore(rdb),
+		storage.NewRedisOddsStore(rdb, cfg.Redis.OddsTTL.Duration), storage.NewRedisOpportunityStore(rdb))
+
+	// Serve /ready straight away so it reports while we wait on dependencies
+	readiness := startup.NewReadiness("detector")
+	mux := http.NewServeMux()
+	readiness.Register(mux)
+	d.RegisterRoutes(mux)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/admin/log-level", telemetry.LevelHandler())
+	startup.ListenAndServe(":"+cfg.HTTP.HealthPort, mux)
+
+	topics := cfg.Kafka.Topics
+	err = readiness.WaitFor(ctx, startup.BackoffFrom(cfg.Startup),
+		startup.Kafka(cfg.Kafka.Brokers, topics.OddsProcessed, topics.ArbitrageFound, topics.EventLifecycle,
+			bus.DeadLetterTopic(topics.OddsProcessed), bus.DeadLetterTopic(topics.EventLifecycle)),
+		startup.Redis(rdb),
+	)
+	if err != nil {
+		telemetry.Fatal("Dependencies not ready", "error", err)
 	}
-}
-
-func (d *Detector) Run() {
-	log.Println("Starting arbitrage detector service")
 
-	// Start cache cleanup routine
-	go d.cleanupOldOdds()
+	// Returns once every consumer has stopped and committed
+	d.Run(ctx)
 
-	for {
-		// Read message from Kafka
-		msg, err := d.consumer.ReadMessage(d.ctx)
-		if err != nil {
-			log.Printf("Error reading message: %v", err)
-			continue
+	stop()
+	err = startup.Shutdown(drain, func(ctx context.Context) {
+		defer shutdownTracing(ctx)
+		if err := b.Close(); err != nil {
+			slog.Error("Error flushing producers", "error", err)
 		}
-
-		// Parse odds update
-		var odds models.OddsUpdate
-		if err := json.Unmarshal(msg.Value, &odds); err != nil {
-			log.Printf("Error parsing message: %v", err)
-			continue
+		if err := rdb.Close(); err != nil {
+			slog.Error("Error closing Redis", "error", err)
 		}
-
-		// Process odds immediately for real-time detection
-		d.processOdds(&odds)
-	}
-}
-
-func (d *Detector) processOdds(newOdds *models.OddsUpdate) {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	// Create cache key
-	cacheKey := fmt.Sprintf("%s:%s", newOdds.EventID, newOdds.Bookmaker)
-	
-	// Update cache
-	d.oddsCache[cacheKey] = newOdds
-
-	// Check for arbitrage against all other bookmakers for same event
-	for key, cachedOdds := range d.oddsCache {
-		// Skip same bookmaker or different events
-		if !strings.HasPrefix(key, newOdds.EventID+":") || key == cacheKey {
-			continue
-		}
-
-		// Check if odds are not too old (within 30 seconds)
-		if time.Since(cachedOdds.Timestamp) > 30*time.Second {
-			continue
-		}
-
-		// Detect arbitrage opportunity
-		arb := d.calculator.DetectArbitrage(newOdds, cachedOdds)
-		if arb != nil {
-			log.Printf("🎯 ARBITRAGE FOUND! %s vs %s - Profit: %.2f%%",
-				arb.HomeTeam, arb.AwayTeam, arb.ProfitPercent)
-
-			// Publish to Kafka for real-time notification
-			if err := d.producer.Send(d.ctx, arb.EventID, arb); err != nil {
-				log.Printf("Error publishing arbitrage: %v", err)
-			}
-
-			// Store in Redis for API access
-			d.storeArbitrage(arb)
-		}
-	}
-}
-
-func (d *Detector) storeArbitrage(arb *models.ArbitrageOpportunity) {
-	// Store in Redis with expiration
-	key := fmt.Sprintf("arbitrage:%s", arb.ID)
-	data, _ := json.Marshal(arb)
-	d.redis.Set(d.ctx, key, data, 5*time.Minute)
-
-	// Add to active arbitrage set
-	d.redis.SAdd(d.ctx, "active_arbitrage", arb.ID)
-	d.redis.Expire(d.ctx, "active_arbitrage", 5*time.Minute)
-}
-
-func (d *Detector) cleanupOldOdds() {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		d.mu.Lock()
-		now := time.Now()
-		for key, odds := range d.oddsCache {
-			if now.Sub(odds.Timestamp) > 60*time.Second {
-				delete(d.oddsCache, key)
-			}
-		}
-		d.mu.Unlock()
+	})
+	if err != nil {
+		telemetry.Fatal("Shutdown failed", "error", err)
 	}
 }
-
-func main() {
-	// Wait for Kafka to be ready
-	time.Sleep(15 * time.Second)
-
-	detector := NewDetector()
-	detector.Run()
-}
\ No newline at end of file
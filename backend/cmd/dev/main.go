@@ -0,0 +1,123 @@
+// Command dev runs fetchers, the normalizer, the detector and the API in one
+// process, wired
+// together over an in-memory bus and in-memory stores, so the pipeline can
+// be exercised without Kafka or Redis running
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/matthewhu/sportarbitrage/internal/api"
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/detector"
+	"github.com/matthewhu/sportarbitrage/internal/fetcher"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/normalizer"
+	"github.com/matthewhu/sportarbitrage/internal/startup"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+	"github.com/matthewhu/sportarbitrage/internal/telemetry"
+)
+
+// defaultSportsbooks are fetched when fetcher.sportsbook is not set
+var defaultSportsbooks = []string{"draftkings", "fanduel", "betmgm", "caesars", "pointsbet"}
+
+func main() {
+	cfg, err := config.Load("dev", os.Args[1:])
+	if errors.Is(err, config.ErrPrintedConfig) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Structured logs; the level can be changed at /admin/log-level
+	if err := telemetry.SetupLogging(telemetry.LoggingOptionsFrom(cfg.Logging), "dev", bus.Instance()); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("Effective config", "config", cfg)
+
+	ctx, stop := startup.SignalContext()
+	defer stop()
+	// Bounds everything left to do once ctx is cancelled
+	drain := startup.DrainContext(ctx, cfg.HTTP.ShutdownTimeout.Duration)
+
+	// Export spans; the pipeline is traced end to end through message headers
+	shutdownTracing, err := telemetry.SetupTracing(ctx, telemetry.TracingOptionsFrom(cfg.Tracing), "dev", bus.Instance())
+	if err != nil {
+		telemetry.Fatal("Error setting up tracing", "error", err)
+	}
+
+	// Create in-memory bus
+	b := bus.NewMemory(cfg.HTTP.BroadcastBuffer)
+
+	// fetcher.sportsbook may list several books separated by commas
+	sportsbooks := defaultSportsbooks
+	if cfg.Fetcher.Sportsbook != "" {
+		sportsbooks = strings.Split(cfg.Fetcher.Sportsbook, ",")
+	}
+
+	// The stores live in memory; the detector params come from its params file
+	quotes := storage.NewMemoryOddsStore(cfg.Redis.OddsTTL.Duration)
+	opportunities := storage.NewMemoryOpportunityStore()
+
+	n := normalizer.NewNormalizer(cfg, b)
+	d := detector.NewDetector(cfg, b, storage.NewMemoryDetectorStateStore(), quotes, opportunities)
+	server := api.NewServer(cfg, b, opportunities, quotes, storage.NewMemoryEventStore())
+
+	mux := http.NewServeMux()
+	d.RegisterRoutes(mux)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/admin/log-level", telemetry.LevelHandler())
+	startup.ListenAndServe(":"+cfg.HTTP.HealthPort, mux)
+
+	var wg sync.WaitGroup
+
+	// Subscribers go first so nothing published at startup is missed
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.Run(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		n.Run(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		server.Run(ctx)
+	}()
+
+	for _, book := range sportsbooks {
+		f := fetcher.NewFetcher(cfg, strings.TrimSpace(book), b, quotes)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.Run(ctx)
+		}()
+	}
+
+	slog.Info("Dev mode running fetchers, normalizer, detector and API", "fetchers", len(sportsbooks), "port", cfg.HTTP.Port)
+	wg.Wait()
+
+	stop()
+	err = startup.Shutdown(drain, func(ctx context.Context) {
+		defer shutdownTracing(ctx)
+		server.Close(ctx)
+		b.Close()
+	})
+	if err != nil {
+		telemetry.Fatal("Shutdown failed", "error", err)
+	}
+}
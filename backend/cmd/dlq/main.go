@@ -0,0 +1,159 @@
+// Command dlq inspects dead-lettered messages and replays them onto the
+// topic they came from.
+//
+//	dlq inspect -topic odds-updates -service detector -error "invalid odds"
+//	dlq replay  -topic odds-updates -since 1h
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/kafka"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// filter selects which dead letters a command acts on
+type filter struct {
+	service  string
+	contains string
+	key      string
+	since    time.Duration
+}
+
+func (f filter) match(letter *models.DeadLetter) bool {
+	if f.service != "" && letter.Service != f.service {
+		return false
+	}
+	if f.contains != "" && !strings.Contains(letter.Error, f.contains) {
+		return false
+	}
+	if f.key != "" && letter.Key != f.key {
+		return false
+	}
+	if f.since > 0 && time.Since(letter.FailedAt) > f.since {
+		return false
+	}
+	return true
+}
+
+// describePayload renders a dead letter's payload as JSON where it can be
+// decoded, and as the raw bytes otherwise
+func describePayload(codecs *kafka.Codecs, letter *models.DeadLetter) string {
+	if letter.Headers[kafka.HeaderContentType] != kafka.ContentTypeAvro {
+		return string(letter.Payload)
+	}
+
+	var decoded map[string]interface{}
+	if err := codecs.Decode(letter.Payload, letter.Headers, &decoded); err != nil {
+		return fmt.Sprintf("%q (%v)", letter.Payload, err)
+	}
+	data, _ := json.Marshal(decoded)
+	return string(data)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlq <inspect|replay> -topic <source topic> [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+	if command != "inspect" && command != "replay" {
+		usage()
+	}
+
+	// Brokers default to the shared config file and env
+	cfg, err := config.Load("dlq", nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	brokers := fs.String("brokers", strings.Join(cfg.Kafka.Brokers, ","), "Kafka brokers, comma separated")
+	topic := fs.String("topic", "", "source topic whose dead letters to read, e.g. odds-updates")
+	var f filter
+	fs.StringVar(&f.service, "service", "", "only letters rejected by this service")
+	fs.StringVar(&f.contains, "error", "", "only letters whose error contains this text")
+	fs.StringVar(&f.key, "key", "", "only letters with this message key")
+	fs.DurationVar(&f.since, "since", 0, "only letters that failed within this long")
+	limit := fs.Int("limit", 0, "stop after this many matching letters, 0 for all")
+	payload := fs.Bool("payload", false, "inspect: print the original payload too")
+	dryRun := fs.Bool("dry-run", false, "replay: list what would be replayed without publishing")
+	fs.Parse(os.Args[2:])
+
+	if *topic == "" {
+		usage()
+	}
+	brokerList := strings.Split(*brokers, ",")
+
+	// Avro payloads are decoded for display with the same schemas the services use
+	codecs, err := kafka.NewCodecs(cfg.Kafka.Encoding, cfg.Kafka.SchemaDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var producer *kafka.Producer
+	if command == "replay" && !*dryRun {
+		producer = kafka.NewProducer(brokerList, *topic)
+		defer producer.Close()
+	}
+
+	errDone := fmt.Errorf("limit reached")
+	matched := 0
+
+	err = kafka.ReadTopic(ctx, brokerList, bus.DeadLetterTopic(*topic), func(msg kafkago.Message) error {
+		var letter models.DeadLetter
+		if err := json.Unmarshal(msg.Value, &letter); err != nil {
+			log.Printf("Skipping unreadable dead letter at offset %d: %v", msg.Offset, err)
+			return nil
+		}
+		if !f.match(&letter) {
+			return nil
+		}
+		matched++
+
+		fmt.Printf("%s\t%s/%d@%d\t%s\tkey=%s\ttrace=%s\t%s\n",
+			letter.FailedAt.Format(time.RFC3339), letter.Topic, letter.Partition, letter.Offset,
+			letter.Service, letter.Key, bus.TraceID(bus.Message{Headers: letter.Headers}), letter.Error)
+		if *payload {
+			fmt.Printf("\t%s\n", describePayload(codecs, &letter))
+		}
+
+		if producer != nil {
+			if err := producer.SendRaw(ctx, letter.Key, letter.Payload, letter.Headers); err != nil {
+				return fmt.Errorf("failed to replay offset %d: %w", letter.Offset, err)
+			}
+		}
+
+		if *limit > 0 && matched >= *limit {
+			return errDone
+		}
+		return nil
+	})
+	if err != nil && err != errDone {
+		log.Fatal(err)
+	}
+
+	switch {
+	case producer != nil:
+		log.Printf("Replayed %d messages onto %s", matched, *topic)
+	default:
+		log.Printf("%d matching dead letters", matched)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/kafka"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/normalizer"
+	"github.com/matthewhu/sportarbitrage/internal/startup"
+	"github.com/matthewhu/sportarbitrage/internal/telemetry"
+)
+
+func main() {
+	cfg, err := config.Load("normalizer", os.Args[1:])
+	if errors.Is(err, config.ErrPrintedConfig) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Structured logs; the level can be changed at /admin/log-level
+	if err := telemetry.SetupLogging(telemetry.LoggingOptionsFrom(cfg.Logging), "normalizer", bus.Instance()); err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("Effective config", "config", cfg)
+
+	ctx, stop := startup.SignalContext()
+	defer stop()
+	// Bounds everything left to do once ctx is cancelled
+	drain := startup.DrainContext(ctx, cfg.HTTP.ShutdownTimeout.Duration)
+
+	// Export spans; the pipeline is traced end to end through message headers
+	shutdownTracing, err := telemetry.SetupTracing(ctx, telemetry.TracingOptionsFrom(cfg.Tracing), "normalizer", bus.Instance())
+	if err != nil {
+		telemetry.Fatal("Error setting up tracing", "error", err)
+	}
+
+	// Create Kafka bus
+	codecs, err := kafka.NewCodecs(cfg.Kafka.Encoding, cfg.Kafka.SchemaDir)
+	if err != nil {
+		telemetry.Fatal("Error loading schemas", "error", err)
+	}
+	b := kafka.NewBus(cfg.Kafka.Brokers, kafka.ConsumerOptionsFrom(cfg.Kafka.Consumer), codecs)
+
+	n := normalizer.NewNormalizer(cfg, b)
+
+	// Serve /ready and /metrics straight away so it reports while we wait on dependencies
+	readiness := startup.NewReadiness("normalizer")
+	mux := http.NewServeMux()
+	readiness.Register(mux)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/admin/log-level", telemetry.LevelHandler())
+	startup.ListenAndServe(":"+cfg.HTTP.HealthPort, mux)
+
+	topics := cfg.Kafka.Topics
+	err = readiness.WaitFor(ctx, startup.BackoffFrom(cfg.Startup),
+		startup.Kafka(cfg.Kafka.Brokers, topics.OddsUpdates, topics.OddsProcessed, bus.DeadLetterTopic(topics.OddsUpdates)),
+	)
+	if err != nil {
+		telemetry.Fatal("Dependencies not ready", "error", err)
+	}
+
+	n.Run(ctx)
+
+	stop()
+	err = startup.Shutdown(drain, func(ctx context.Context) {
+		defer shutdownTracing(ctx)
+		if err := b.Close(); err != nil {
+			slog.Error("Error flushing producers", "error", err)
+		}
+	})
+	if err != nil {
+		telemetry.Fatal("Shutdown failed", "error", err)
+	}
+}
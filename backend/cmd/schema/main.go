@@ -0,0 +1,77 @@
+// Command schema checks the schema registry and adds new schema versions
+// once they pass the compatibility check.
+//
+//	schema check
+//	schema add -subject odds-update -file odds-update.avsc
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hamba/avro/v2"
+	"github.com/matthewhu/sportarbitrage/internal/schema"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: schema <check|add> [-dir schemas] [-subject name -file schema.avsc]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	dir := fs.String("dir", "internal/schema/schemas", "schema registry directory")
+	subject := fs.String("subject", "", "add: subject to add a version to")
+	file := fs.String("file", "", "add: candidate schema file")
+	fs.Parse(os.Args[2:])
+
+	// Loading runs the compatibility check over every existing version
+	registry, err := schema.NewFileRegistry(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch command {
+	case "check":
+		for _, s := range registry.Subjects() {
+			fmt.Printf("%s: %d versions, compatible\n", s, registry.Versions(s))
+		}
+
+	case "add":
+		if *subject == "" || *file == "" {
+			usage()
+		}
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		candidate, err := avro.Parse(string(data))
+		if err != nil {
+			log.Fatalf("Invalid schema: %v", err)
+		}
+		if err := registry.CheckCandidate(*subject, candidate); err != nil {
+			log.Fatalf("Incompatible schema: %v", err)
+		}
+
+		version := registry.Versions(*subject) + 1
+		target := filepath.Join(*dir, *subject, fmt.Sprintf("v%d.avsc", version))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Registered %s v%d at %s\n", *subject, version, target)
+
+	default:
+		usage()
+	}
+}
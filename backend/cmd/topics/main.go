@@ -0,0 +1,59 @@
+// Command topics creates the Kafka topics the services read and write,
+// with their dead-letter topics. Services only check the topics exist, so
+// run it once before starting them.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/kafka"
+)
+
+func main() {
+	cfg, err := config.Load("topics", os.Args[1:])
+	if errors.Is(err, config.ErrPrintedConfig) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	t := cfg.Kafka.Topics
+	var topics []string
+	for _, topic := range []string{t.OddsUpdates, t.OddsProcessed, t.ArbitrageFound, t.EventLifecycle} {
+		topics = append(topics, topic, bus.DeadLetterTopic(topic))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Kafka may still be starting, so keep trying for a minute
+	for {
+		err = kafka.CreateTopics(ctx, cfg.Kafka.Brokers, topics)
+		if err == nil {
+			break
+		}
+		log.Printf("Kafka not ready: %v", err)
+
+		select {
+		case <-ctx.Done():
+			log.Fatalf("Error creating topics: %v", err)
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	missing, err := kafka.MissingTopics(ctx, cfg.Kafka.Brokers, topics)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(missing) > 0 {
+		log.Fatalf("Topics still missing: %v", missing)
+	}
+	log.Printf("Topics ready: %v", topics)
+}
@@ -1,9 +1,13 @@
 -- Create tables for storing arbitrage history and analytics
+--
+-- Only runs on a fresh volume. Any change here needs a matching migration
+-- in internal/storage/migrate.go for databases created before it.
 
 CREATE TABLE IF NOT EXISTS arbitrage_history (
     id UUID PRIMARY KEY,
     event_id VARCHAR(255) NOT NULL,
     sport VARCHAR(50) NOT NULL,
+    market_type VARCHAR(50) NOT NULL DEFAULT 'moneyline',
     home_team VARCHAR(255) NOT NULL,
     away_team VARCHAR(255) NOT NULL,
     bookmaker_home VARCHAR(100) NOT NULL,
@@ -15,12 +19,19 @@ CREATE TABLE IF NOT EXISTS arbitrage_history (
     away_stake DECIMAL(10, 2) NOT NULL,
     total_stake DECIMAL(10, 2) NOT NULL,
     expected_return DECIMAL(10, 2) NOT NULL,
+    live BOOLEAN NOT NULL DEFAULT FALSE,
+    confidence DECIMAL(5, 4) NOT NULL DEFAULT 1,
     created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
     expires_at TIMESTAMP NOT NULL,
+    closed_at TIMESTAMP,
+    close_reason VARCHAR(20),
+    lifetime_seconds DECIMAL(12, 3),
     status VARCHAR(20) DEFAULT 'active'
 );
 
 CREATE INDEX idx_arbitrage_created_at ON arbitrage_history(created_at DESC);
+CREATE INDEX idx_arbitrage_open ON arbitrage_history(expires_at) WHERE closed_at IS NULL;
 CREATE INDEX idx_arbitrage_event_id ON arbitrage_history(event_id);
 CREATE INDEX idx_arbitrage_profit ON arbitrage_history(profit_percent DESC);
 
@@ -31,20 +42,34 @@ CREATE TABLE IF NOT EXISTS events (
     home_team VARCHAR(255) NOT NULL,
     away_team VARCHAR(255) NOT NULL,
     start_time TIMESTAMP,
+    end_time TIMESTAMP,
     status VARCHAR(20) DEFAULT 'upcoming',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Partitioned by day; the odds recorder creates partitions ahead of time
+-- and drops them once they are past the retention period
 CREATE TABLE IF NOT EXISTS odds_history (
-    id SERIAL PRIMARY KEY,
+    id BIGSERIAL,
     event_id VARCHAR(255) NOT NULL,
     bookmaker VARCHAR(100) NOT NULL,
     home_odds DECIMAL(10, 3) NOT NULL,
     away_odds DECIMAL(10, 3) NOT NULL,
     draw_odds DECIMAL(10, 3),
     market_type VARCHAR(50) NOT NULL,
-    timestamp TIMESTAMP NOT NULL
-);
+    timestamp TIMESTAMP NOT NULL,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
 
 CREATE INDEX idx_odds_event_timestamp ON odds_history(event_id, timestamp DESC);
-CREATE INDEX idx_odds_bookmaker ON odds_history(bookmaker);
\ No newline at end of file
+CREATE INDEX idx_odds_bookmaker ON odds_history(bookmaker);
+
+-- The latest quote of every book for every event, when Postgres rather
+-- than Redis holds the odds cache
+CREATE TABLE IF NOT EXISTS latest_odds (
+    event_id VARCHAR(255) NOT NULL,
+    bookmaker VARCHAR(100) NOT NULL,
+    data JSONB NOT NULL,
+    saved_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (event_id, bookmaker)
+);
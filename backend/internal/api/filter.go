@@ -0,0 +1,335 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+)
+
+// filter selects opportunities. It is read from the query string of
+// /api/arbitrage and /ws and from WebSocket subscribe messages, so REST
+// and push clients share one language:
+//
+//	sport=NBA,NHL              any of the sports
+//	league=NBA                 any of the leagues
+//	bookmaker=a,b              both legs at these books
+//	exclude_bookmaker=c        neither leg at these books
+//	market_type=moneyline      any of the market types
+//	min_profit=1.5             profit percent bounds, inclusive
+//	max_profit=10
+//	min_stake=500              smaller leg's stake at least this
+//	starts_before=2024-05-01T18:00:00Z
+//	live=true                  in-play only; false for pre-match only
+//
+// Lists are comma separated and matched case-insensitively. League and
+// start time come from the event catalogue, so those filters leave out
+// opportunities on events it doesn't know.
+type filter struct {
+	sports       map[string]bool
+	leagues      map[string]bool
+	bookmakers   map[string]bool
+	excluded     map[string]bool
+	marketTypes  map[string]bool
+	minProfit    *float64
+	maxProfit    *float64
+	minStake     *float64
+	startsBefore time.Time
+	live         *bool
+
+	query string // as given, echoed back to WebSocket clients
+}
+
+// parseFilter reads a filter from query parameters. Parameters it doesn't
+// know are ignored, so paging parameters can share the query string.
+func parseFilter(values url.Values) (*filter, error) {
+	f := &filter{
+		sports:      parseList(values.Get("sport")),
+		leagues:     parseList(values.Get("league")),
+		bookmakers:  parseList(values.Get("bookmaker")),
+		excluded:    parseList(values.Get("exclude_bookmaker")),
+		marketTypes: parseList(values.Get("market_type")),
+	}
+
+	var err error
+	if f.minProfit, err = parseFloat(values, "min_profit"); err != nil {
+		return nil, err
+	}
+	if f.maxProfit, err = parseFloat(values, "max_profit"); err != nil {
+		return nil, err
+	}
+	if f.minStake, err = parseFloat(values, "min_stake"); err != nil {
+		return nil, err
+	}
+	if f.minProfit != nil && f.maxProfit != nil && *f.minProfit > *f.maxProfit {
+		return nil, fmt.Errorf("min_profit is above max_profit")
+	}
+
+	if v := values.Get("starts_before"); v != "" {
+		if f.startsBefore, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, fmt.Errorf("starts_before must be an RFC 3339 time")
+		}
+	}
+	if v := values.Get("live"); v != "" {
+		live, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("live must be true or false")
+		}
+		f.live = &live
+	}
+
+	// Only the filter's own parameters are echoed
+	echoed := url.Values{}
+	for _, key := range []string{"sport", "league", "bookmaker", "exclude_bookmaker", "market_type",
+		"min_profit", "max_profit", "min_stake", "starts_before", "live"} {
+		if v := values.Get(key); v != "" {
+			echoed.Set(key, v)
+		}
+	}
+	f.query = echoed.Encode()
+
+	return f, nil
+}
+
+func parseList(v string) map[string]bool {
+	if v == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			set[item] = true
+		}
+	}
+	return set
+}
+
+func parseFloat(values url.Values, key string) (*float64, error) {
+	v := values.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", key)
+	}
+	return &n, nil
+}
+
+// empty reports whether the filter passes everything. query holds every
+// parameter the filter was given.
+func (f *filter) empty() bool {
+	return f.query == ""
+}
+
+// needsEvents reports whether matching looks at the event catalogue
+func (f *filter) needsEvents() bool {
+	return f.leagues != nil || !f.startsBefore.IsZero()
+}
+
+// match reports whether arb passes the filter. ev is its event from the
+// catalogue, nil if unknown.
+func (f *filter) match(arb *models.ArbitrageOpportunity, ev *models.Event) bool {
+	if f.sports != nil && !f.sports[strings.ToLower(arb.Sport)] {
+		return false
+	}
+	if f.marketTypes != nil && !f.marketTypes[strings.ToLower(arb.MarketType)] {
+		return false
+	}
+
+	home, away := strings.ToLower(arb.BookmakerHome), strings.ToLower(arb.BookmakerAway)
+	if f.bookmakers != nil && !(f.bookmakers[home] && f.bookmakers[away]) {
+		return false
+	}
+	if f.excluded[home] || f.excluded[away] {
+		return false
+	}
+
+	if f.minProfit != nil && arb.ProfitPercent < *f.minProfit {
+		return false
+	}
+	if f.maxProfit != nil && arb.ProfitPercent > *f.maxProfit {
+		return false
+	}
+	// The smaller leg bounds what can be placed on the opportunity
+	if f.minStake != nil && min(arb.HomeStake, arb.AwayStake) < *f.minStake {
+		return false
+	}
+	if f.live != nil && arb.Live != *f.live {
+		return false
+	}
+
+	if f.leagues != nil && (ev == nil || !f.leagues[strings.ToLower(ev.League)]) {
+		return false
+	}
+	if !f.startsBefore.IsZero() && (ev == nil || ev.StartTime.IsZero() || !ev.StartTime.Before(f.startsBefore)) {
+		return false
+	}
+	return true
+}
+
+// Sort keys for /api/arbitrage
+const (
+	sortProfit  = "profit"
+	sortCreated = "created"
+	sortExpiry  = "expiry"
+)
+
+// ordering sorts opportunities by one key, ties broken by ID so every
+// opportunity has a fixed place for cursors to point at
+type ordering struct {
+	key  string
+	desc bool
+}
+
+// parseOrdering reads sort and order. Profit and creation default to the
+// highest and newest first, expiry to the soonest first.
+func parseOrdering(values url.Values) (ordering, error) {
+	o := ordering{key: values.Get("sort")}
+	switch o.key {
+	case "":
+		o.key = sortExpiry
+	case sortExpiry:
+	case sortProfit, sortCreated:
+		o.desc = true
+	default:
+		return o, fmt.Errorf("sort must be profit, created or expiry")
+	}
+
+	switch values.Get("order") {
+	case "":
+	case "asc":
+		o.desc = false
+	case "desc":
+		o.desc = true
+	default:
+		return o, fmt.Errorf("order must be asc or desc")
+	}
+	return o, nil
+}
+
+// sortValue is an opportunity's sort key: a profit, or a time in Unix
+// nanoseconds, which a float64 can't hold exactly
+type sortValue struct {
+	profit float64
+	nanos  int64
+}
+
+// value returns arb's sort key. Expiries are compared to the millisecond,
+// as the stores do, so listings soonest to expire first match the store's.
+func (o ordering) value(arb *models.ArbitrageOpportunity) sortValue {
+	switch o.key {
+	case sortProfit:
+		return sortValue{profit: arb.ProfitPercent}
+	case sortCreated:
+		return sortValue{nanos: arb.CreatedAt.UnixNano()}
+	default:
+		return sortValue{nanos: arb.ExpiresAt.Truncate(time.Millisecond).UnixNano()}
+	}
+}
+
+// inStoreOrder reports whether listings sorted as o can be paged in the
+// store, which lists opportunities soonest to expire first
+func (o ordering) inStoreOrder() bool {
+	return o.key == sortExpiry && !o.desc
+}
+
+// before reports whether an item with value a and ID idA comes before
+// one with value b and ID idB
+func (o ordering) before(a sortValue, idA string, b sortValue, idB string) bool {
+	if a != b {
+		less := a.profit < b.profit || (a.profit == b.profit && a.nanos < b.nanos)
+		return less != o.desc
+	}
+	return idA < idB
+}
+
+func (o ordering) sort(opportunities []models.ArbitrageOpportunity) {
+	sort.Slice(opportunities, func(i, j int) bool {
+		a, b := &opportunities[i], &opportunities[j]
+		return o.before(o.value(a), a.ID, o.value(b), b.ID)
+	})
+}
+
+// cursor points just past the last opportunity of a page. It holds that
+// opportunity's sort value and ID rather than an offset, so a page
+// neither repeats nor skips opportunities when others open or close
+// ahead of it.
+type cursor struct {
+	ordering
+	last sortValue
+	id   string
+}
+
+// cursorAfter points past arb in a listing sorted as o
+func cursorAfter(o ordering, arb *models.ArbitrageOpportunity) *cursor {
+	return &cursor{ordering: o, last: o.value(arb), id: arb.ID}
+}
+
+func (c *cursor) encode() string {
+	order := "asc"
+	if c.desc {
+		order = "desc"
+	}
+	value := strconv.FormatInt(c.last.nanos, 10)
+	if c.key == sortProfit {
+		value = strconv.FormatFloat(c.last.profit, 'g', -1, 64)
+	}
+	raw := strings.Join([]string{c.key, order, value, c.id}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseCursor decodes a cursor, which must come from a listing sorted as o
+func parseCursor(s string, o ordering) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 4)
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if parts[0] != o.key || (parts[1] == "desc") != o.desc {
+		return nil, fmt.Errorf("cursor is from a listing sorted differently")
+	}
+
+	c := &cursor{ordering: o, id: parts[3]}
+	if o.key == sortProfit {
+		c.last.profit, err = strconv.ParseFloat(parts[2], 64)
+	} else {
+		c.last.nanos, err = strconv.ParseInt(parts[2], 10, 64)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return c, nil
+}
+
+// position is where the cursor resumes a listing in the store, nil for
+// the start. Only cursors of listings in the store's order have one.
+func (c *cursor) position() *storage.Position {
+	if c == nil {
+		return nil
+	}
+	return &storage.Position{ExpiresAt: time.Unix(0, c.last.nanos), ID: c.id}
+}
+
+// after drops the sorted opportunities up to and including the cursor's
+func (c *cursor) after(sorted []models.ArbitrageOpportunity) []models.ArbitrageOpportunity {
+	if c == nil {
+		return sorted
+	}
+	i := sort.Search(len(sorted), func(i int) bool {
+		return c.before(c.last, c.id, c.value(&sorted[i]), sorted[i].ID)
+	})
+	return sorted[i:]
+}
@@ -0,0 +1,307 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantQuery string
+		wantErr   bool
+	}{
+		{name: "empty", query: ""},
+		{name: "unknown parameters are ignored", query: "limit=10&cursor=abc"},
+		{
+			name:      "only filter parameters are echoed",
+			query:     "sport=NBA,NHL&limit=10&min_profit=1.5",
+			wantQuery: "min_profit=1.5&sport=NBA%2CNHL",
+		},
+		{
+			name:      "every parameter",
+			query:     "sport=nba&league=NBA&bookmaker=a,b&exclude_bookmaker=c&market_type=moneyline&min_profit=1&max_profit=10&min_stake=500&starts_before=2026-05-01T18:00:00Z&live=false",
+			wantQuery: "bookmaker=a%2Cb&exclude_bookmaker=c&league=NBA&live=false&market_type=moneyline&max_profit=10&min_profit=1&min_stake=500&sport=nba&starts_before=2026-05-01T18%3A00%3A00Z",
+		},
+		{name: "min_profit not a number", query: "min_profit=lots", wantErr: true},
+		{name: "min_stake not a number", query: "min_stake=plenty", wantErr: true},
+		{name: "empty values are ignored", query: "max_profit=&min_stake=&live="},
+		{name: "min_profit above max_profit", query: "min_profit=5&max_profit=1", wantErr: true},
+		{name: "starts_before not RFC 3339", query: "starts_before=2026-05-01", wantErr: true},
+		{name: "live not a bool", query: "live=maybe", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := parseFilter(values)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseFilter(%q) succeeded, want an error", tt.query)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFilter(%q): %v", tt.query, err)
+			}
+			if f.query != tt.wantQuery {
+				t.Errorf("query = %q, want %q", f.query, tt.wantQuery)
+			}
+			if f.empty() != (tt.wantQuery == "") {
+				t.Errorf("empty() = %v, want %v", f.empty(), tt.wantQuery == "")
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	start := time.Date(2026, 5, 1, 18, 0, 0, 0, time.UTC)
+	arb := &models.ArbitrageOpportunity{
+		ID:            "arb-1",
+		EventID:       "lakers-vs-celtics",
+		Sport:         "NBA",
+		MarketType:    "moneyline",
+		BookmakerHome: "BookA",
+		BookmakerAway: "BookB",
+		ProfitPercent: 2.5,
+		HomeStake:     450,
+		AwayStake:     550,
+		TotalStake:    1000,
+	}
+	ev := &models.Event{ID: "lakers-vs-celtics", League: "NBA", StartTime: start}
+
+	tests := []struct {
+		name    string
+		query   string
+		noEvent bool
+		want    bool
+	}{
+		{name: "empty filter", query: "", want: true},
+		{name: "sport is case-insensitive", query: "sport=nba,nhl", want: true},
+		{name: "other sport", query: "sport=NHL", want: false},
+		{name: "market type", query: "market_type=MONEYLINE", want: true},
+		{name: "other market type", query: "market_type=spread", want: false},
+		{name: "both legs at listed books", query: "bookmaker=booka,bookb,bookc", want: true},
+		{name: "one leg at an unlisted book", query: "bookmaker=booka", want: false},
+		{name: "excluded book", query: "exclude_bookmaker=bookb", want: false},
+		{name: "other book excluded", query: "exclude_bookmaker=bookc", want: true},
+		{name: "profit bounds are inclusive", query: "min_profit=2.5&max_profit=2.5", want: true},
+		{name: "below min_profit", query: "min_profit=3", want: false},
+		{name: "above max_profit", query: "max_profit=2", want: false},
+		{name: "smaller leg at min_stake", query: "min_stake=450", want: true},
+		{name: "smaller leg below min_stake", query: "min_stake=500", want: false},
+		{name: "pre-match", query: "live=false", want: true},
+		{name: "in-play only", query: "live=true", want: false},
+		{name: "league", query: "league=nba", want: true},
+		{name: "other league", query: "league=NHL", want: false},
+		{name: "league of an unknown event", query: "league=NBA", noEvent: true, want: false},
+		{name: "starts before", query: "starts_before=2026-05-01T18:00:01Z", want: true},
+		{name: "starts at the bound", query: "starts_before=2026-05-01T18:00:00Z", want: false},
+		{name: "start of an unknown event", query: "starts_before=2026-05-02T00:00:00Z", noEvent: true, want: false},
+		{name: "unknown event without catalogue filters", query: "sport=NBA", noEvent: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := parseFilter(values)
+			if err != nil {
+				t.Fatalf("parseFilter(%q): %v", tt.query, err)
+			}
+			event := ev
+			if tt.noEvent {
+				event = nil
+			}
+			if got := f.match(arb, event); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOrdering(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    ordering
+		wantErr bool
+	}{
+		{query: "", want: ordering{key: sortExpiry}},
+		{query: "sort=expiry", want: ordering{key: sortExpiry}},
+		{query: "sort=expiry&order=desc", want: ordering{key: sortExpiry, desc: true}},
+		{query: "sort=profit", want: ordering{key: sortProfit, desc: true}},
+		{query: "sort=profit&order=asc", want: ordering{key: sortProfit}},
+		{query: "sort=created", want: ordering{key: sortCreated, desc: true}},
+		{query: "order=desc", want: ordering{key: sortExpiry, desc: true}},
+		{query: "sort=stake", wantErr: true},
+		{query: "sort=profit&order=up", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseOrdering(values)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseOrdering(%q) = %+v, want an error", tt.query, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOrdering(%q): %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseOrdering(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+// orderings lists every sort key in both directions
+var orderings = []ordering{
+	{key: sortExpiry}, {key: sortExpiry, desc: true},
+	{key: sortProfit}, {key: sortProfit, desc: true},
+	{key: sortCreated}, {key: sortCreated, desc: true},
+}
+
+// pagingOpportunities returns opportunities with tied profits, creation
+// times and expiries, the expiries tied only to the millisecond
+func pagingOpportunities() []models.ArbitrageOpportunity {
+	base := time.Date(2026, 5, 1, 18, 0, 0, 0, time.UTC)
+	var opportunities []models.ArbitrageOpportunity
+	for i := 0; i < 12; i++ {
+		opportunities = append(opportunities, models.ArbitrageOpportunity{
+			ID:            "arb-" + strconv.Itoa(11-i),
+			ProfitPercent: float64(i%3) + 0.1,
+			CreatedAt:     base.Add(time.Duration(i%4) * time.Second),
+			ExpiresAt:     base.Add(time.Duration(i%5)*time.Minute + time.Duration(i)*time.Microsecond),
+		})
+	}
+	return opportunities
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	arb := &pagingOpportunities()[7]
+	for _, o := range orderings {
+		t.Run(o.key+"/"+strconv.FormatBool(o.desc), func(t *testing.T) {
+			c := cursorAfter(o, arb)
+			got, err := parseCursor(c.encode(), o)
+			if err != nil {
+				t.Fatalf("parseCursor: %v", err)
+			}
+			if *got != *c {
+				t.Errorf("parseCursor(encode()) = %+v, want %+v", *got, *c)
+			}
+
+			other := ordering{key: o.key, desc: !o.desc}
+			if _, err := parseCursor(c.encode(), other); err == nil {
+				t.Errorf("cursor accepted by a listing sorted %+v", other)
+			}
+		})
+	}
+}
+
+func TestParseCursorInvalid(t *testing.T) {
+	o := ordering{key: sortProfit, desc: true}
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "too few parts", cursor: "cHJvZml0fGRlc2M"},
+		{name: "other sort key", cursor: cursorAfter(ordering{key: sortCreated, desc: true}, &models.ArbitrageOpportunity{ID: "a"}).encode()},
+		{name: "value not a number", cursor: "cHJvZml0fGRlc2N8eHx4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if c, err := parseCursor(tt.cursor, o); err == nil {
+				t.Errorf("parseCursor(%q) = %+v, want an error", tt.cursor, c)
+			}
+		})
+	}
+
+	if c, err := parseCursor("", o); c != nil || err != nil {
+		t.Errorf("parseCursor(\"\") = %v, %v, want the start", c, err)
+	}
+}
+
+// TestCursorPaging pages through every ordering and checks the pages
+// join up into the sorted listing, ties included
+func TestCursorPaging(t *testing.T) {
+	for _, o := range orderings {
+		for _, limit := range []int{1, 5, 12} {
+			t.Run(o.key+"/"+strconv.FormatBool(o.desc)+"/"+strconv.Itoa(limit), func(t *testing.T) {
+				sorted := pagingOpportunities()
+				o.sort(sorted)
+				for i := 1; i < len(sorted); i++ {
+					a, b := &sorted[i-1], &sorted[i]
+					if !o.before(o.value(a), a.ID, o.value(b), b.ID) {
+						t.Fatalf("%s sorted after %s", a.ID, b.ID)
+					}
+				}
+
+				var paged []string
+				var c *cursor
+				for pages := 0; ; pages++ {
+					if pages > len(sorted) {
+						t.Fatal("paging doesn't end")
+					}
+					page := c.after(sorted)
+					if len(page) == 0 {
+						break
+					}
+					page = page[:min(limit, len(page))]
+					for _, arb := range page {
+						paged = append(paged, arb.ID)
+					}
+
+					// Cursors travel through the query string
+					var err error
+					if c, err = parseCursor(cursorAfter(o, &page[len(page)-1]).encode(), o); err != nil {
+						t.Fatalf("parseCursor: %v", err)
+					}
+				}
+
+				if len(paged) != len(sorted) {
+					t.Fatalf("paged %d opportunities, want %d", len(paged), len(sorted))
+				}
+				for i := range sorted {
+					if paged[i] != sorted[i].ID {
+						t.Fatalf("page item %d = %s, want %s", i, paged[i], sorted[i].ID)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCursorPosition(t *testing.T) {
+	arb := &models.ArbitrageOpportunity{
+		ID:        "arb-1",
+		ExpiresAt: time.Date(2026, 5, 1, 18, 0, 0, 123456789, time.UTC),
+	}
+	c := cursorAfter(ordering{key: sortExpiry}, arb)
+	pos := c.position()
+	if want := time.Date(2026, 5, 1, 18, 0, 0, 123000000, time.UTC); !pos.ExpiresAt.Equal(want) || pos.ID != arb.ID {
+		t.Errorf("position() = %+v, want %v and %s", pos, want, arb.ID)
+	}
+
+	var start *cursor
+	if start.position() != nil {
+		t.Error("position() of no cursor isn't the start")
+	}
+}
@@ -0,0 +1,678 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/websocket/v2"
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/startup"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+	"github.com/matthewhu/sportarbitrage/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxBulkEvents caps the events one /api/odds request may ask for, so a
+// request is one bounded Redis pipeline
+const maxBulkEvents = 100
+
+// maxPageSize caps the limit of one /api/arbitrage page
+const maxPageSize = 500
+
+// maxScan caps the opportunities a filtered or re-sorted listing reads
+// from the store, the soonest to expire. Unfiltered listings soonest to
+// expire first are paged in the store and see everything.
+const maxScan = 10000
+
+// Server serves the REST API and pushes arbitrage to WebSocket clients
+type Server struct {
+	cfg       *config.Config
+	app       *fiber.App
+	readiness *startup.Readiness
+	bus       bus.Bus
+	odds      storage.OddsStore
+	store     storage.OpportunityStore
+	events    storage.EventStore
+	ctx       context.Context
+	logger    *slog.Logger
+	clients   map[*websocket.Conn]*client
+	broadcast chan outbound
+	mu        sync.RWMutex
+
+	// IDs already pushed, so redelivered messages aren't sent to clients twice
+	seen   map[string]time.Time // opportunity states pushed, until the opportunity expires
+	seenMu sync.Mutex
+
+	// Event catalogue for league and start time filters, reloaded every
+	// http.events_refresh
+	catalogue   map[string]*models.Event
+	catalogueMu sync.RWMutex
+
+	consumerDone  chan struct{}
+	broadcastDone chan struct{}
+}
+
+// client is a WebSocket connection and the filter it subscribed with
+type client struct {
+	conn   *websocket.Conn
+	mu     sync.Mutex // serialises writes and guards the rest
+	filter *filter
+	sent   map[string]time.Time // opportunities pushed, until they expire
+}
+
+// NewServer creates a server pushing arbitrage from b and serving the open
+// opportunities in store and the quotes in odds. Opportunities are matched
+// against the events in events for league and start time filters.
+func NewServer(cfg *config.Config, b bus.Bus, store storage.OpportunityStore, odds storage.OddsStore, events storage.EventStore) *Server {
+	// Fiber's banner would break up the JSON log stream
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+
+	// Configure CORS
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:  "*",
+		AllowHeaders:  "Origin, Content-Type, Accept",
+		ExposeHeaders: "X-Total-Count, X-Next-Cursor",
+	}))
+
+	// Log requests as structured lines like everything else
+	app.Use(func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		slog.Info("HTTP request", "component", "api", "method", c.Method(), "path", c.Path(),
+			"status", c.Response().StatusCode(), "duration_ms", time.Since(start).Milliseconds())
+		return err
+	})
+
+	server := &Server{
+		cfg:       cfg,
+		app:       app,
+		readiness: startup.NewReadiness("api"),
+		bus:       b,
+		odds:      odds,
+		store:     store,
+		events:    events,
+		ctx:       context.Background(),
+		logger:    slog.With("component", "api"),
+		clients:   make(map[*websocket.Conn]*client),
+		broadcast: make(chan outbound, cfg.HTTP.BroadcastBuffer),
+		seen:      make(map[string]time.Time),
+		catalogue: make(map[string]*models.Event),
+	}
+
+	server.setupRoutes()
+	return server
+}
+
+func (s *Server) setupRoutes() {
+	// Health check
+	s.app.Get("/health", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"status": "healthy",
+			"time":   time.Now(),
+		})
+	})
+
+	// Prometheus metrics
+	s.app.Get("/metrics", adaptor.HTTPHandler(metrics.Handler()))
+
+	// Runtime log level
+	s.app.All("/admin/log-level", adaptor.HTTPHandler(telemetry.LevelHandler()))
+
+	// Readiness of Kafka and Redis
+	s.app.Get("/ready", func(c *fiber.Ctx) error {
+		report := s.readiness.Report()
+		if !report.Ready {
+			c.Status(fiber.StatusServiceUnavailable)
+		}
+		return c.JSON(report)
+	})
+
+	// Get active arbitrage opportunities matching the filter in the query,
+	// ordered by sort and order, soonest to expire first by default. limit
+	// caps the page; X-Next-Cursor is set when more follow and passing it
+	// back as cursor fetches them. X-Total-Count tells how many match.
+	// Listings with a filter or another order only consider the maxScan
+	// opportunities soonest to expire.
+	s.app.Get("/api/arbitrage", func(c *fiber.Ctx) error {
+		values, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+		if err != nil {
+			return badRequest(c, err)
+		}
+		f, err := parseFilter(values)
+		if err != nil {
+			return badRequest(c, err)
+		}
+		o, err := parseOrdering(values)
+		if err != nil {
+			return badRequest(c, err)
+		}
+		after, err := parseCursor(values.Get("cursor"), o)
+		if err != nil {
+			return badRequest(c, err)
+		}
+		limit := c.QueryInt("limit")
+		if limit < 0 || limit > maxPageSize {
+			return badRequest(c, fmt.Errorf("limit must be between 0 and %d", maxPageSize))
+		}
+
+		var page []models.ArbitrageOpportunity
+		if f.empty() && o.inStoreOrder() {
+			// One more than the limit tells whether another page follows
+			resume := storage.Page{After: after.position()}
+			if limit > 0 {
+				resume.Limit = limit + 1
+			}
+			var total int
+			page, total = s.getActiveArbitrage(resume)
+			c.Set("X-Total-Count", strconv.Itoa(total))
+		} else {
+			opportunities := s.matchingArbitrage(f)
+			o.sort(opportunities)
+			c.Set("X-Total-Count", strconv.Itoa(len(opportunities)))
+			page = after.after(opportunities)
+		}
+
+		if limit > 0 && len(page) > limit {
+			page = page[:limit]
+			c.Set("X-Next-Cursor", cursorAfter(o, &page[limit-1]).encode())
+		}
+		return c.JSON(page)
+	})
+
+	// Get current odds for several events, e.g. /api/odds?events=a,b,c
+	s.app.Get("/api/odds", func(c *fiber.Ctx) error {
+		var eventIDs []string
+		for _, id := range strings.Split(c.Query("events"), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				eventIDs = append(eventIDs, id)
+			}
+		}
+		if len(eventIDs) == 0 || len(eventIDs) > maxBulkEvents {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("events must list 1 to %d event IDs", maxBulkEvents),
+			})
+		}
+		return c.JSON(s.getEventsOdds(eventIDs))
+	})
+
+	// Get current odds for an event
+	s.app.Get("/api/odds/:eventId", func(c *fiber.Ctx) error {
+		eventID := c.Params("eventId")
+		odds := s.getEventOdds(eventID)
+		return c.JSON(odds)
+	})
+
+	// WebSocket endpoint. The query may hold a filter, as for
+	// /api/arbitrage; clients can change it later with a subscribe message.
+	s.app.Get("/ws", func(c *fiber.Ctx) error {
+		values, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+		if err != nil {
+			return badRequest(c, err)
+		}
+		f, err := parseFilter(values)
+		if err != nil {
+			return badRequest(c, err)
+		}
+		c.Locals("filter", f)
+		return c.Next()
+	}, websocket.New(func(c *websocket.Conn) {
+		s.handleWebSocket(c)
+	}))
+
+	// Static file serving for frontend
+	s.app.Static("/", "./frontend/build")
+}
+
+func badRequest(c *fiber.Ctx, err error) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+}
+
+// subscribeMessage replaces a WebSocket client's filter, given as a query
+// string, e.g. {"type":"subscribe","filter":"sport=NBA&min_profit=2"}
+type subscribeMessage struct {
+	Type   string `json:"type"`
+	Filter string `json:"filter"`
+}
+
+func (s *Server) handleWebSocket(conn *websocket.Conn) {
+	f, _ := conn.Locals("filter").(*filter)
+	if f == nil {
+		f = &filter{}
+	}
+	cl := &client{conn: conn, filter: f, sent: make(map[string]time.Time)}
+
+	// Register client
+	s.mu.Lock()
+	s.clients[conn] = cl
+	clients := len(s.clients)
+	s.mu.Unlock()
+	metrics.WebSocketClients.Inc()
+
+	s.logger.Info("WebSocket client connected", "remote_addr", conn.RemoteAddr().String(), "filter", f.query, "clients", clients)
+
+	// Send current active arbitrage opportunities
+	s.sendSnapshot(cl)
+
+	// Keep connection alive and handle messages
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, conn)
+		clients := len(s.clients)
+		s.mu.Unlock()
+		metrics.WebSocketClients.Dec()
+		conn.Close()
+		s.logger.Info("WebSocket client disconnected", "remote_addr", conn.RemoteAddr().String(), "clients", clients)
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				s.logger.Warn("WebSocket error", "remote_addr", conn.RemoteAddr().String(), "error", err)
+			}
+			break
+		}
+
+		// Send pong for ping messages
+		if messageType == websocket.PingMessage {
+			cl.mu.Lock()
+			conn.WriteMessage(websocket.PongMessage, []byte{})
+			cl.mu.Unlock()
+			continue
+		}
+
+		if messageType == websocket.TextMessage {
+			s.handleClientMessage(cl, data)
+		}
+	}
+}
+
+// handleClientMessage acts on a message from a WebSocket client. A
+// subscribe swaps the client's filter and resends the matching
+// opportunities; the reply is a status message with the filter in force.
+func (s *Server) handleClientMessage(cl *client, data []byte) {
+	var sub subscribeMessage
+	err := json.Unmarshal(data, &sub)
+	if err == nil && sub.Type != "subscribe" {
+		err = fmt.Errorf("unknown message type %q", sub.Type)
+	}
+
+	var f *filter
+	if err == nil {
+		var values url.Values
+		if values, err = url.ParseQuery(sub.Filter); err == nil {
+			f, err = parseFilter(values)
+		}
+	}
+
+	if err != nil {
+		cl.mu.Lock()
+		cl.conn.WriteJSON(models.WebSocketMessage{
+			Type:      "status",
+			Data:      fiber.Map{"error": err.Error()},
+			Timestamp: time.Now(),
+		})
+		cl.mu.Unlock()
+		return
+	}
+
+	cl.mu.Lock()
+	cl.filter = f
+	cl.sent = make(map[string]time.Time)
+	cl.conn.WriteJSON(models.WebSocketMessage{
+		Type:      "status",
+		Data:      fiber.Map{"filter": f.query},
+		Timestamp: time.Now(),
+	})
+	cl.mu.Unlock()
+
+	s.logger.Info("WebSocket client subscribed", "remote_addr", cl.conn.RemoteAddr().String(), "filter", f.query)
+	s.sendSnapshot(cl)
+}
+
+// sendSnapshot pushes the open opportunities matching the client's filter
+func (s *Server) sendSnapshot(cl *client) {
+	cl.mu.Lock()
+	f := cl.filter
+	cl.mu.Unlock()
+
+	opportunities := s.matchingArbitrage(f)
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	for _, arb := range opportunities {
+		msg := models.WebSocketMessage{
+			Type:      "arbitrage",
+			Data:      arb,
+			Timestamp: time.Now(),
+		}
+		cl.conn.WriteJSON(msg)
+		cl.sent[arb.ID] = arb.ExpiresAt
+	}
+}
+
+// outbound is an opportunity queued for push, with the trace it arrived on
+type outbound struct {
+	arb       models.ArbitrageOpportunity
+	span      trace.SpanContext
+	fetchedAt time.Time // zero if the message didn't say
+}
+
+func (s *Server) broadcastToClients() {
+	defer close(s.broadcastDone)
+
+	for out := range s.broadcast {
+		ctx, span := telemetry.Start(trace.ContextWithSpanContext(s.ctx, out.span), "websocket broadcast")
+
+		msg := models.WebSocketMessage{
+			Type:      "arbitrage",
+			Data:      out.arb,
+			Timestamp: time.Now(),
+		}
+		ev := s.lookupEvent(out.arb.EventID)
+
+		s.mu.RLock()
+		clients := 0
+		for _, cl := range s.clients {
+			push, ok := cl.route(&out.arb, ev, msg)
+			if !ok {
+				continue
+			}
+			clients++
+			if err := cl.write(push); err != nil {
+				s.logger.WarnContext(ctx, "Error broadcasting to client", "remote_addr", cl.conn.RemoteAddr().String(), "error", err)
+				cl.conn.Close()
+			}
+		}
+		s.mu.RUnlock()
+
+		span.SetAttributes(attribute.Int("websocket.clients", clients))
+
+		// End-to-end latency from the bookmaker fetch to the push
+		if !out.fetchedAt.IsZero() {
+			latency := time.Since(out.fetchedAt)
+			metrics.PushLatency.Observe(latency.Seconds())
+			span.SetAttributes(attribute.Int64("fetch_to_push_ms", latency.Milliseconds()))
+			s.logger.InfoContext(ctx, "Pushed arbitrage", "arb_id", out.arb.ID, "clients", clients,
+				"fetch_to_push_ms", latency.Milliseconds())
+		}
+		span.End()
+	}
+}
+
+// route decides what the client is sent for arb: msg if arb matches its
+// filter, the closing state if it was sent the opportunity, and a removal
+// if the opportunity stopped matching. ok is false when nothing is sent.
+func (cl *client) route(arb *models.ArbitrageOpportunity, ev *models.Event, msg models.WebSocketMessage) (models.WebSocketMessage, bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	now := time.Now()
+	for id, expiresAt := range cl.sent {
+		if now.After(expiresAt) {
+			delete(cl.sent, id)
+		}
+	}
+
+	_, sent := cl.sent[arb.ID]
+	switch {
+	case arb.Event == models.OpportunityClosed:
+		delete(cl.sent, arb.ID)
+		return msg, sent
+	case cl.filter.match(arb, ev):
+		cl.sent[arb.ID] = arb.ExpiresAt
+		return msg, true
+	case sent:
+		delete(cl.sent, arb.ID)
+		return models.WebSocketMessage{
+			Type:      "arbitrage_removed",
+			Data:      fiber.Map{"id": arb.ID},
+			Timestamp: msg.Timestamp,
+		}, true
+	default:
+		return msg, false
+	}
+}
+
+func (cl *client) write(msg models.WebSocketMessage) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.conn.WriteJSON(msg)
+}
+
+func (s *Server) consumeArbitrageEvents(ctx context.Context) {
+	defer close(s.consumerDone)
+
+	s.logger.Info("Starting consumer for arbitrage events")
+
+	err := s.bus.Subscribe(ctx, s.cfg.Kafka.Topics.ArbitrageFound, s.cfg.Kafka.Groups.API, s.handleArbitrage)
+	if err != nil {
+		s.logger.Error("Arbitrage subscription ended", "error", err)
+	}
+}
+
+func (s *Server) handleArbitrage(ctx context.Context, msg bus.Message) {
+	ctx, span := bus.StartConsume(ctx, msg)
+	defer span.End()
+
+	var arb models.ArbitrageOpportunity
+	if err := msg.Decode(&arb); err != nil {
+		bus.DeadLetter(ctx, s.bus, "api", msg, fmt.Errorf("failed to parse arbitrage: %w", err))
+		return
+	}
+	if err := arb.Validate(); err != nil {
+		bus.DeadLetter(ctx, s.bus, "api", msg, fmt.Errorf("invalid arbitrage: %w", err))
+		return
+	}
+
+	defer func() {
+		if err := s.bus.Ack(ctx, msg); err != nil {
+			s.logger.ErrorContext(ctx, "Error acking message", append(msg.LogAttrs(), "error", err)...)
+		}
+	}()
+
+	// A new group replays the topic from the start; what has expired
+	// since is no use to clients. Closes still go out so clients holding
+	// the opportunity drop it.
+	if arb.Event != models.OpportunityClosed && !time.Now().Before(arb.ExpiresAt) {
+		s.logger.DebugContext(ctx, "Skipping expired arbitrage", "arb_id", arb.ID, "expires_at", arb.ExpiresAt)
+		return
+	}
+
+	if !s.markSeen(&arb) {
+		return
+	}
+
+	out := outbound{arb: arb, span: span.SpanContext()}
+	out.fetchedAt, _ = bus.FetchedAt(msg)
+
+	s.logger.InfoContext(ctx, "Received arbitrage", "arb_id", arb.ID, "event_id", arb.EventID, "event", arb.Event,
+		"profit_percent", arb.ProfitPercent, "producer", msg.Headers[bus.HeaderProducerInstance])
+
+	// Send to broadcast channel for real-time WebSocket push
+	select {
+	case s.broadcast <- out:
+	default:
+		metrics.BroadcastDrops.Inc()
+		s.logger.WarnContext(ctx, "Broadcast channel full, dropping message", "arb_id", arb.ID)
+	}
+}
+
+// markSeen records arb as pushed and reports whether it is new. An
+// opportunity is published again under its ID as it changes and closes,
+// so each state is told apart by its event and update time.
+func (s *Server) markSeen(arb *models.ArbitrageOpportunity) bool {
+	s.seenMu.Lock()
+	defer s.seenMu.Unlock()
+
+	now := time.Now()
+	for key, expiresAt := range s.seen {
+		if now.After(expiresAt) {
+			delete(s.seen, key)
+		}
+	}
+
+	key := fmt.Sprintf("%s:%s:%d", arb.ID, arb.Event, arb.UpdatedAt.UnixNano())
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+	s.seen[key] = arb.ExpiresAt
+	return true
+}
+
+func (s *Server) getActiveArbitrage(page storage.Page) ([]models.ArbitrageOpportunity, int) {
+	opportunities, total, err := s.store.ActiveOpportunities(s.ctx, page)
+	if err != nil {
+		s.logger.Error("Error getting active arbitrage", "error", err)
+	}
+	return opportunities, total
+}
+
+// matchingArbitrage returns the active opportunities passing f among the
+// maxScan soonest to expire, soonest first
+func (s *Server) matchingArbitrage(f *filter) []models.ArbitrageOpportunity {
+	opportunities, total := s.getActiveArbitrage(storage.Page{Limit: maxScan})
+	if total > len(opportunities) {
+		s.logger.Debug("Matching only the opportunities soonest to expire", "scanned", len(opportunities), "open", total)
+	}
+
+	matching := opportunities[:0]
+	for i := range opportunities {
+		var ev *models.Event
+		if f.needsEvents() {
+			ev = s.lookupEvent(opportunities[i].EventID)
+		}
+		if f.match(&opportunities[i], ev) {
+			matching = append(matching, opportunities[i])
+		}
+	}
+	return matching
+}
+
+// lookupEvent returns an event from the catalogue, nil if it isn't known
+func (s *Server) lookupEvent(eventID string) *models.Event {
+	s.catalogueMu.RLock()
+	defer s.catalogueMu.RUnlock()
+	return s.catalogue[eventID]
+}
+
+// refreshCatalogue reloads the event catalogue every http.events_refresh
+// until ctx is cancelled, keeping the last good copy if a load fails
+func (s *Server) refreshCatalogue(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.HTTP.EventsRefresh.Duration)
+	defer ticker.Stop()
+
+	for {
+		events, err := s.events.ListEvents(ctx)
+		if err != nil {
+			s.logger.Error("Error loading events", "error", err)
+		} else {
+			catalogue := make(map[string]*models.Event, len(events))
+			for i := range events {
+				catalogue[events[i].ID] = &events[i]
+			}
+			s.catalogueMu.Lock()
+			s.catalogue = catalogue
+			s.catalogueMu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) getEventOdds(eventID string) []models.OddsUpdate {
+	odds, err := s.odds.EventOdds(s.ctx, eventID)
+	if err != nil {
+		s.logger.Error("Error getting event odds", "event_id", eventID, "error", err)
+	}
+	return odds
+}
+
+func (s *Server) getEventsOdds(eventIDs []string) map[string][]models.OddsUpdate {
+	odds, err := s.odds.EventsOdds(s.ctx, eventIDs)
+	if err != nil {
+		s.logger.Error("Error getting odds", "events", len(eventIDs), "error", err)
+		return map[string][]models.OddsUpdate{}
+	}
+	return odds
+}
+
+// Run serves HTTP and pushes arbitrage to clients until ctx is cancelled.
+// /ready reports unavailable until every check passes.
+func (s *Server) Run(ctx context.Context, checks ...startup.Check) {
+	// Start HTTP server first so /ready reports while we wait on dependencies
+	port := s.cfg.HTTP.Port
+
+	go func() {
+		s.logger.Info("Starting API server", "port", port)
+		if err := s.app.Listen(":" + port); err != nil {
+			telemetry.Fatal("API server stopped", "error", err)
+		}
+	}()
+
+	err := s.readiness.WaitFor(ctx, startup.BackoffFrom(s.cfg.Startup), checks...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		telemetry.Fatal("Dependencies not ready", "error", err)
+	}
+
+	// Keep the event catalogue fresh for filters
+	go s.refreshCatalogue(ctx)
+
+	// Start arbitrage consumer in background
+	s.consumerDone = make(chan struct{})
+	go s.consumeArbitrageEvents(ctx)
+
+	// Start WebSocket broadcaster
+	s.broadcastDone = make(chan struct{})
+	go s.broadcastToClients()
+
+	<-ctx.Done()
+}
+
+// Close stops consuming, pushes whatever is still queued to clients, sends
+// every client a close frame and then stops the HTTP server. The bus and
+// stores belong to the caller.
+func (s *Server) Close(ctx context.Context) {
+	if s.consumerDone != nil {
+		<-s.consumerDone
+		close(s.broadcast)
+		<-s.broadcastDone
+	}
+
+	s.mu.Lock()
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for conn, cl := range s.clients {
+		cl.mu.Lock()
+		if err := conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second)); err != nil {
+			s.logger.Warn("Error sending close frame", "error", err)
+		}
+		cl.mu.Unlock()
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	if err := s.app.ShutdownWithContext(ctx); err != nil {
+		s.logger.Error("Error shutting down HTTP server", "error", err)
+	}
+}
@@ -10,13 +10,15 @@ import (
 
 // Calculator handles arbitrage detection
 type Calculator struct {
-	minProfit float64 // Minimum profit percentage to consider
+	minProfit  float64 // Minimum profit percentage to consider
+	totalStake float64 // Bankroll split across the legs of each opportunity
 }
 
 // NewCalculator creates a new arbitrage calculator
-func NewCalculator(minProfit float64) *Calculator {
+func NewCalculator(minProfit, totalStake float64) *Calculator {
 	return &Calculator{
-		minProfit: minProfit,
+		minProfit:  minProfit,
+		totalStake: totalStake,
 	}
 }
 
@@ -73,8 +75,8 @@ func (c *Calculator) DetectArbitrage(odds1, odds2 *models.OddsUpdate) *models.Ar
 		return nil
 	}
 
-	// Calculate optimal stakes for $1000 total bet
-	totalStake := 1000.0
+	// Calculate optimal stakes for the configured total bet
+	totalStake := c.totalStake
 	homeStake := (totalStake * impliedProbHome) / totalImpliedProb
 	awayStake := (totalStake * impliedProbAway) / totalImpliedProb
 	expectedReturn := totalStake * (1.0 + profitPercent/100)
@@ -0,0 +1,79 @@
+package arbitrage
+
+import (
+	"time"
+)
+
+// FreshnessPolicy decides how old a quote may be before it is ignored and
+// how long a detected opportunity is expected to last
+type FreshnessPolicy struct {
+	PreMatchMaxAge  map[string]time.Duration // per market type
+	LiveMaxAge      map[string]time.Duration // per market type
+	DefaultPreMatch time.Duration
+	DefaultLive     time.Duration
+	PreMatchExpiry  time.Duration
+	LiveExpiry      time.Duration
+
+	// A pair's window is never shorter than either book's min age,
+	// typically how often it is polled, or its quotes would go stale
+	// between polls
+	MinAges       map[string]time.Duration // per bookmaker
+	DefaultMinAge time.Duration
+}
+
+// MaxAge returns the freshness window for a market quoted by books
+func (p FreshnessPolicy) MaxAge(marketType string, live bool, books ...string) time.Duration {
+	window := p.window(marketType, live)
+	for _, book := range books {
+		window = max(window, p.minAge(book))
+	}
+	return window
+}
+
+func (p FreshnessPolicy) minAge(book string) time.Duration {
+	if d, ok := p.MinAges[book]; ok {
+		return d
+	}
+	return p.DefaultMinAge
+}
+
+func (p FreshnessPolicy) window(marketType string, live bool) time.Duration {
+	if live {
+		if d, ok := p.LiveMaxAge[marketType]; ok {
+			return d
+		}
+		return p.DefaultLive
+	}
+
+	if d, ok := p.PreMatchMaxAge[marketType]; ok {
+		return d
+	}
+	return p.DefaultPreMatch
+}
+
+// Expiry returns how long an opportunity stays valid after detection
+func (p FreshnessPolicy) Expiry(live bool) time.Duration {
+	if live {
+		return p.LiveExpiry
+	}
+	return p.PreMatchExpiry
+}
+
+// Confidence scores an opportunity from 1 (legs quoted at the same instant)
+// down to 0 (legs quoted a full freshness window apart)
+func Confidence(leg1, leg2 time.Time, maxAge time.Duration) float64 {
+	if maxAge <= 0 {
+		return 0
+	}
+
+	skew := leg1.Sub(leg2)
+	if skew < 0 {
+		skew = -skew
+	}
+
+	confidence := 1.0 - float64(skew)/float64(maxAge)
+	if confidence < 0 {
+		return 0
+	}
+	return confidence
+}
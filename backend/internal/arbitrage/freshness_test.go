@@ -0,0 +1,68 @@
+package arbitrage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreshnessMaxAge(t *testing.T) {
+	policy := FreshnessPolicy{
+		PreMatchMaxAge:  map[string]time.Duration{"spread": 30 * time.Second},
+		LiveMaxAge:      map[string]time.Duration{"moneyline": 5 * time.Second, "spread": 3 * time.Second},
+		DefaultPreMatch: 20 * time.Second,
+		DefaultLive:     4 * time.Second,
+		MinAges:         map[string]time.Duration{"fast": time.Second, "quick": 2 * time.Second},
+		DefaultMinAge:   10 * time.Second,
+	}
+
+	tests := []struct {
+		name   string
+		market string
+		live   bool
+		books  []string
+		want   time.Duration
+	}{
+		{name: "live spread, fast books", market: "spread", live: true, books: []string{"fast", "quick"}, want: 3 * time.Second},
+		{name: "live moneyline, fast books", market: "moneyline", live: true, books: []string{"fast", "quick"}, want: 5 * time.Second},
+		{name: "live default, fast books", market: "total", live: true, books: []string{"fast", "quick"}, want: 4 * time.Second},
+		{name: "live spread, one slow book", market: "spread", live: true, books: []string{"fast", "slow"}, want: 10 * time.Second},
+		{name: "pre-match spread", market: "spread", books: []string{"fast", "slow"}, want: 30 * time.Second},
+		{name: "pre-match default", market: "total", books: []string{"fast", "quick"}, want: 20 * time.Second},
+		{name: "no books", market: "spread", live: true, want: 3 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.MaxAge(tt.market, tt.live, tt.books...); got != tt.want {
+				t.Errorf("MaxAge(%s, %v, %v) = %v, want %v", tt.market, tt.live, tt.books, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	at := time.Date(2026, 3, 1, 19, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		skew   time.Duration
+		maxAge time.Duration
+		want   float64
+	}{
+		{name: "same instant", skew: 0, maxAge: 3 * time.Second, want: 1},
+		{name: "a third of the window", skew: time.Second, maxAge: 3 * time.Second, want: 2.0 / 3},
+		{name: "order doesn't matter", skew: -time.Second, maxAge: 3 * time.Second, want: 2.0 / 3},
+		{name: "a full window", skew: 3 * time.Second, maxAge: 3 * time.Second, want: 0},
+		{name: "beyond the window", skew: 5 * time.Second, maxAge: 3 * time.Second, want: 0},
+		{name: "no window", skew: 0, maxAge: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Confidence(at, at.Add(tt.skew), tt.maxAge)
+			if diff := got - tt.want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("Confidence() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package batch
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+)
+
+// Options size a Writer's batches and buffer
+type Options struct {
+	Size          int           // items per save
+	FlushInterval time.Duration // longest a partial batch waits
+	BufferSize    int           // items held while saves fail; Add waits once full
+	RetryInterval time.Duration
+	DrainTimeout  time.Duration // how long saving goes on once Run's ctx ends
+}
+
+// SaveFunc writes one batch
+type SaveFunc[T any] func(ctx context.Context, items []T) error
+
+// Writer buffers items and saves them in batches, retrying failed saves
+// until they succeed. The buffer is bounded, so callers of Add are held
+// back while the store is down rather than running out of memory.
+type Writer[T any] struct {
+	name   string // labels metrics, e.g. the table written
+	opts   Options
+	save   SaveFunc[T]
+	queue  chan T
+	logger *slog.Logger
+}
+
+// NewWriter creates a writer saving batches of items with save
+func NewWriter[T any](name string, opts Options, save SaveFunc[T]) *Writer[T] {
+	return &Writer[T]{
+		name:   name,
+		opts:   opts,
+		save:   save,
+		queue:  make(chan T, opts.BufferSize),
+		logger: slog.With("component", "batch", "table", name),
+	}
+}
+
+// Add queues an item, waiting while the buffer is full. It reports false
+// if ctx ended first.
+func (w *Writer[T]) Add(ctx context.Context, item T) bool {
+	select {
+	case w.queue <- item:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Close stops the writer taking items. Run returns once the rest are saved.
+func (w *Writer[T]) Close() {
+	close(w.queue)
+}
+
+// Run saves a batch once it is full or the flush interval passes, until
+// Close is called and the buffer is drained. Once ctx ends, saving goes
+// on for the drain timeout; whatever is left after that is dropped.
+func (w *Writer[T]) Run(ctx context.Context) {
+	saveCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	context.AfterFunc(ctx, func() {
+		time.AfterFunc(w.opts.DrainTimeout, cancel)
+	})
+
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]T, 0, w.opts.Size)
+	for {
+		select {
+		case item, ok := <-w.queue:
+			if !ok {
+				w.write(saveCtx, batch)
+				metrics.RowsBuffered.WithLabelValues(w.name).Set(0)
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) < w.opts.Size {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if !w.write(saveCtx, batch) {
+			return
+		}
+		batch = batch[:0]
+		metrics.RowsBuffered.WithLabelValues(w.name).Set(float64(len(w.queue)))
+	}
+}
+
+// write saves a batch, retrying until it succeeds or ctx ends. The buffer
+// fills up meanwhile. It reports false if it gave up, dropping the batch
+// and everything still buffered.
+func (w *Writer[T]) write(ctx context.Context, batch []T) bool {
+	if len(batch) == 0 {
+		return true
+	}
+
+	for {
+		err := w.save(ctx, batch)
+		if err == nil {
+			metrics.RowsWritten.WithLabelValues(w.name).Add(float64(len(batch)))
+			return true
+		}
+
+		metrics.WriteErrors.WithLabelValues(w.name).Inc()
+		metrics.RowsBuffered.WithLabelValues(w.name).Set(float64(len(batch) + len(w.queue)))
+		w.logger.Warn("Error writing batch, will retry", "rows", len(batch), "buffered", len(w.queue), "error", err)
+
+		select {
+		case <-ctx.Done():
+			w.logger.Error("Gave up writing batches", "rows", len(batch)+len(w.queue))
+			return false
+		case <-time.After(w.opts.RetryInterval):
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Message is a payload delivered to a subscriber
+type Message struct {
+	Topic     string
+	Key       string
+	Value     []byte
+	Headers   map[string]string
+	Partition int
+	Offset    int64
+	Timestamp time.Time
+	Group     string
+	// Generation is the consumer group generation an owned subscription
+	// delivered the message in. Acks from an earlier one are dropped, as
+	// its partitions may have moved to another member.
+	Generation int
+
+	// Decoder reads Value according to Headers. Nil means Value is JSON.
+	Decoder Decoder
+}
+
+// LogAttrs identifies the message in log lines
+func (m Message) LogAttrs() []any {
+	return []any{"topic", m.Topic, "partition", m.Partition, "offset", m.Offset}
+}
+
+// Decoder turns an encoded payload back into a value
+type Decoder interface {
+	Decode(data []byte, headers map[string]string, v interface{}) error
+}
+
+// Decode reads the message's payload into v
+func (m Message) Decode(v interface{}) error {
+	if m.Decoder == nil {
+		return json.Unmarshal(m.Value, v)
+	}
+	return m.Decoder.Decode(m.Value, m.Headers, v)
+}
+
+// Handler processes one message. It calls Bus.Ack once the message's side
+// effects are done; unacked messages may be delivered again. A handler
+// that finishes the work later, e.g. in a batch, calls Bus.Defer instead
+// and acks once it is done.
+type Handler func(ctx context.Context, msg Message)
+
+// Partitioner reports the partition a key's messages are published to
+type Partitioner func(key string) int
+
+// Owner keeps state for the partitions a SubscribeOwned member owns
+type Owner interface {
+	// Assigned loads state for newly owned partitions. Delivery waits for
+	// it. partitionOf tells which keys belong to them.
+	Assigned(ctx context.Context, partitions []int, partitionOf Partitioner) error
+
+	// Revoked saves and drops state for partitions the member gave up
+	Revoked(ctx context.Context, partitions []int)
+}
+
+// Bus carries messages between services
+type Bus interface {
+	// Publish encodes value and sends it to topic under key
+	Publish(ctx context.Context, topic, key string, value interface{}) error
+
+	// Subscribe delivers the topic's messages to handler, one at a time,
+	// until ctx is cancelled. Subscribers sharing a group split the
+	// messages between them, every group sees every message.
+	Subscribe(ctx context.Context, topic, group string, handler Handler) error
+
+	// SubscribeOwned consumes several topics as one group member that owns
+	// a share of their partitions. The topics must be keyed alike and have
+	// the same number of partitions; a member owns the same partition
+	// numbers of every topic, so all messages for a key reach one member.
+	// owner hears of each assignment before its messages are delivered and
+	// of each revocation after the last one is handled.
+	SubscribeOwned(ctx context.Context, group string, topics []string, handler Handler, owner Owner) error
+
+	// Ack marks a message as processed. Acking a message acks every
+	// message before it on its partition.
+	Ack(ctx context.Context, msg Message) error
+
+	// Defer tells the subscription the handler took msg on and will ack it
+	// later, so the messages after it are delivered meanwhile. If the
+	// process dies first, msg is delivered again.
+	Defer(ctx context.Context, msg Message) error
+
+	// Close flushes pending publishes
+	Close() error
+}
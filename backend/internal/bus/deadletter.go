@@ -0,0 +1,77 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// DeadLetterTopic names the topic that failed messages from topic go to
+func DeadLetterTopic(topic string) string {
+	return topic + "-dlq"
+}
+
+// DeadLetter routes msg to its topic's dead-letter topic along with the
+// error and the service that rejected it, then acks it. If the dead
+// letter can't be published msg is left unacked so it is retried.
+func DeadLetter(ctx context.Context, b Bus, service string, msg Message, cause error) {
+	if err := PublishDeadLetter(ctx, b, service, msg, cause); err != nil {
+		return
+	}
+	if err := b.Ack(ctx, msg); err != nil {
+		slog.ErrorContext(ctx, "Error acking after dead-lettering", append(msg.LogAttrs(), "error", err)...)
+	}
+}
+
+// PublishDeadLetter routes msg to its topic's dead-letter topic like
+// DeadLetter but leaves acking it to the caller, for handlers that ack in
+// offset order
+func PublishDeadLetter(ctx context.Context, b Bus, service string, msg Message, cause error) error {
+	letter := models.DeadLetter{
+		Service:   service,
+		Error:     cause.Error(),
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Headers:   msg.Headers,
+		Payload:   msg.Value,
+		FailedAt:  time.Now(),
+	}
+
+	logger := slog.With(msg.LogAttrs()...)
+	logger.WarnContext(ctx, "Dead-lettering message", "rejected_by", service, "error", cause)
+	metrics.DeadLetters.WithLabelValues(msg.Topic, service).Inc()
+
+	if err := b.Publish(ctx, DeadLetterTopic(msg.Topic), msg.Key, letter); err != nil {
+		logger.ErrorContext(ctx, "Error publishing dead letter", "error", err)
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+	return nil
+}
+
+// AckLatest acks the last of msgs on each partition, which acks the rest
+func AckLatest(ctx context.Context, b Bus, msgs []Message) error {
+	type partition struct {
+		topic string
+		id    int
+	}
+	latest := make(map[partition]Message)
+	for _, msg := range msgs {
+		p := partition{msg.Topic, msg.Partition}
+		if last, ok := latest[p]; !ok || msg.Offset > last.Offset {
+			latest[p] = msg
+		}
+	}
+
+	for _, msg := range latest {
+		if err := b.Ack(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
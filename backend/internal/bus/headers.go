@@ -0,0 +1,158 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers every published message carries, alongside the codec's own
+const (
+	HeaderProducerService  = "producer-service"
+	HeaderProducerInstance = "producer-instance"
+	HeaderFetchedAt        = "fetched-at"  // when the bookmaker's odds were fetched, RFC 3339
+	HeaderTraceParent      = "traceparent" // W3C trace context, set by the OpenTelemetry propagator
+)
+
+type headersKey struct{}
+
+// WithHeaders returns a context whose publishes carry headers, on top of
+// any already set on ctx
+func WithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range OutgoingHeaders(ctx) {
+		merged[k] = v
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, headersKey{}, merged)
+}
+
+// OutgoingHeaders returns the headers publishes on ctx carry
+func OutgoingHeaders(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(headersKey{}).(map[string]string)
+	return headers
+}
+
+// WithProducer tags publishes on ctx with the service and instance
+// producing them
+func WithProducer(ctx context.Context, service string) context.Context {
+	return WithHeaders(ctx, map[string]string{
+		HeaderProducerService:  service,
+		HeaderProducerInstance: Instance(),
+	})
+}
+
+// Instance identifies this process, as hostname-pid
+func Instance() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// WithFetchedAt records when the odds behind what is published on ctx
+// were fetched from the bookmaker
+func WithFetchedAt(ctx context.Context, fetchedAt time.Time) context.Context {
+	return WithHeaders(ctx, map[string]string{
+		HeaderFetchedAt: fetchedAt.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// Continue carries msg's trace context and fetch time on to ctx, so spans
+// started and messages published on it join msg's trace
+func Continue(ctx context.Context, msg Message) context.Context {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(msg.Headers))
+	if fetchedAt, ok := msg.Headers[HeaderFetchedAt]; ok {
+		ctx = WithHeaders(ctx, map[string]string{HeaderFetchedAt: fetchedAt})
+	}
+	return ctx
+}
+
+// StartConsume continues msg's trace on ctx with a consumer span for
+// processing it
+func StartConsume(ctx context.Context, msg Message) (context.Context, trace.Span) {
+	return telemetry.Start(Continue(ctx, msg), msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", msg.Topic),
+			attribute.String("messaging.consumer.group.name", msg.Group),
+			attribute.Int("messaging.kafka.destination.partition", msg.Partition),
+			attribute.Int64("messaging.kafka.message.offset", msg.Offset),
+			attribute.String("messaging.kafka.message.key", msg.Key),
+		),
+	)
+}
+
+// StartPublish starts a producer span for publishing to topic
+func StartPublish(ctx context.Context, topic string) (context.Context, trace.Span) {
+	return telemetry.Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.destination.name", topic)),
+	)
+}
+
+// PublishHeaders returns the headers a message published on ctx carries:
+// those set with WithHeaders plus the current trace context
+func PublishHeaders(ctx context.Context) map[string]string {
+	headers := make(map[string]string)
+	for k, v := range OutgoingHeaders(ctx) {
+		headers[k] = v
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+	return headers
+}
+
+// TraceID returns the trace msg belongs to, or "" if it has none
+func TraceID(msg Message) string {
+	return traceID(msg.Headers[HeaderTraceParent])
+}
+
+// ContextTraceID returns the trace of the span on ctx
+func ContextTraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+func traceID(traceparent string) string {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
+
+// FetchedAt returns when the odds behind msg were fetched
+func FetchedAt(msg Message) (time.Time, bool) {
+	return parseFetchedAt(msg.Headers)
+}
+
+// ContextFetchedAt returns when the odds behind publishes on ctx were fetched
+func ContextFetchedAt(ctx context.Context) (time.Time, bool) {
+	return parseFetchedAt(OutgoingHeaders(ctx))
+}
+
+func parseFetchedAt(headers map[string]string) (time.Time, bool) {
+	value, ok := headers[HeaderFetchedAt]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
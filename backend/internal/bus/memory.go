@@ -0,0 +1,185 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+)
+
+// Memory is an in-process Bus built on channels, for tests and the
+// single-process dev mode. Like a Kafka group starting at the latest
+// offset, a group only sees messages published after it subscribed.
+type Memory struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+	buffer int
+	closed bool
+	done   chan struct{} // closed by Close
+}
+
+type memoryTopic struct {
+	offset int64
+	groups map[string]*memoryGroup
+}
+
+type memoryGroup struct {
+	ch          chan Message
+	subscribers int
+	done        chan struct{} // closed once the last subscriber leaves
+}
+
+// NewMemory creates an in-memory bus. Each group buffers up to buffer
+// messages before Publish blocks, until ctx ends, the group's last
+// subscriber leaves or the bus is closed.
+func NewMemory(buffer int) *Memory {
+	return &Memory{
+		topics: make(map[string]*memoryTopic),
+		buffer: buffer,
+		done:   make(chan struct{}),
+	}
+}
+
+func (m *Memory) topic(name string) *memoryTopic {
+	t, ok := m.topics[name]
+	if !ok {
+		t = &memoryTopic{groups: make(map[string]*memoryGroup)}
+		m.topics[name] = t
+	}
+	return t
+}
+
+// Publish JSON-encodes value and hands it, with ctx's headers, to every
+// subscribed group
+func (m *Memory) Publish(ctx context.Context, topic, key string, value interface{}) error {
+	ctx, span := StartPublish(ctx, topic)
+	defer span.End()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		metrics.PublishErrors.WithLabelValues(topic).Inc()
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return fmt.Errorf("bus is closed")
+	}
+	t := m.topic(topic)
+	msg := Message{
+		Topic:     topic,
+		Key:       key,
+		Value:     data,
+		Headers:   PublishHeaders(ctx),
+		Offset:    t.offset,
+		Timestamp: time.Now(),
+	}
+	t.offset++
+
+	var targets []*memoryGroup
+	for _, g := range t.groups {
+		targets = append(targets, g)
+	}
+	m.mu.Unlock()
+
+	for _, g := range targets {
+		select {
+		case g.ch <- msg:
+		case <-g.done:
+			// Nobody is left to read it
+		case <-m.done:
+			metrics.PublishErrors.WithLabelValues(topic).Inc()
+			return fmt.Errorf("bus is closed")
+		case <-ctx.Done():
+			metrics.PublishErrors.WithLabelValues(topic).Inc()
+			return ctx.Err()
+		}
+	}
+	metrics.MessagesProduced.WithLabelValues(topic).Inc()
+
+	return nil
+}
+
+// Subscribe delivers messages to handler until ctx is cancelled
+func (m *Memory) Subscribe(ctx context.Context, topic, group string, handler Handler) error {
+	m.mu.Lock()
+	t := m.topic(topic)
+	g, ok := t.groups[group]
+	if !ok {
+		g = &memoryGroup{ch: make(chan Message, m.buffer), done: make(chan struct{})}
+		t.groups[group] = g
+	}
+	g.subscribers++
+	m.mu.Unlock()
+
+	// Stop routing to the group once its last subscriber leaves
+	defer func() {
+		m.mu.Lock()
+		g.subscribers--
+		if g.subscribers == 0 {
+			delete(t.groups, group)
+			close(g.done)
+		}
+		m.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-g.ch:
+			metrics.MessagesConsumed.WithLabelValues(topic, group).Inc()
+			metrics.ConsumerLag.WithLabelValues(topic, group).Set(float64(len(g.ch)))
+			msg.Group = group
+			handler(ctx, msg)
+		}
+	}
+}
+
+// SubscribeOwned consumes every topic as group. In-memory topics have a
+// single partition, 0, which the member owns until ctx is cancelled.
+func (m *Memory) SubscribeOwned(ctx context.Context, group string, topics []string, handler Handler, owner Owner) error {
+	partitions := []int{0}
+	partitionOf := func(key string) int { return 0 }
+	if err := owner.Assigned(ctx, partitions, partitionOf); err != nil {
+		return fmt.Errorf("failed to take ownership: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, topic := range topics {
+		wg.Add(1)
+		go func(topic string) {
+			defer wg.Done()
+			m.Subscribe(ctx, topic, group, handler)
+		}(topic)
+	}
+	wg.Wait()
+
+	owner.Revoked(context.WithoutCancel(ctx), partitions)
+	return nil
+}
+
+// Ack is a no-op, in-memory messages are never redelivered
+func (m *Memory) Ack(ctx context.Context, msg Message) error {
+	return nil
+}
+
+// Defer is a no-op, like Ack
+func (m *Memory) Defer(ctx context.Context, msg Message) error {
+	return nil
+}
+
+// Close rejects further publishes and releases any waiting on a full group
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
+	return nil
+}
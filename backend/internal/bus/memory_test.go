@@ -0,0 +1,105 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stuckGroup subscribes a group whose handler blocks on its first message
+// until its context ends, then fills the group's buffer
+func stuckGroup(t *testing.T, m *Memory, ctx context.Context) {
+	t.Helper()
+
+	go m.Subscribe(ctx, "odds", "stuck", func(ctx context.Context, msg Message) {
+		<-ctx.Done()
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		m.mu.Lock()
+		_, ok := m.topic("odds").groups["stuck"]
+		m.mu.Unlock()
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("group never subscribed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Publish until one times out, so the handler holds one message and
+	// the buffer is full
+	for i := 0; ; i++ {
+		pubCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := m.Publish(pubCtx, "odds", "key", i)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return
+		}
+		if err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		if i > 10 {
+			t.Fatal("buffer never filled")
+		}
+	}
+}
+
+func TestMemoryPublishUnblocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		release func(m *Memory, cancelPublish, cancelSubscriber context.CancelFunc)
+		wantErr bool
+	}{
+		{
+			name:    "publish context cancelled",
+			release: func(m *Memory, cancelPublish, cancelSubscriber context.CancelFunc) { cancelPublish() },
+			wantErr: true,
+		},
+		{
+			name:    "last subscriber left",
+			release: func(m *Memory, cancelPublish, cancelSubscriber context.CancelFunc) { cancelSubscriber() },
+		},
+		{
+			name:    "bus closed",
+			release: func(m *Memory, cancelPublish, cancelSubscriber context.CancelFunc) { m.Close() },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemory(1)
+			subCtx, cancelSubscriber := context.WithCancel(context.Background())
+			defer cancelSubscriber()
+			stuckGroup(t, m, subCtx)
+
+			pubCtx, cancelPublish := context.WithCancel(context.Background())
+			defer cancelPublish()
+			result := make(chan error, 1)
+			go func() {
+				result <- m.Publish(pubCtx, "odds", "key", "blocked")
+			}()
+
+			select {
+			case err := <-result:
+				t.Fatalf("Publish returned %v before the group was released", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			tt.release(m, cancelPublish, cancelSubscriber)
+
+			select {
+			case err := <-result:
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Publish error = %v, want error %v", err, tt.wantErr)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Publish still blocked after the group was released")
+			}
+		})
+	}
+}
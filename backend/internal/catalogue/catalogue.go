@@ -0,0 +1,185 @@
+package catalogue
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/events"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+)
+
+// retention is how long past its end a final event is kept, matching how
+// long the detector remembers dropped events. Later schedule entries for
+// it are ignored.
+const retention = 24 * time.Hour
+
+// Catalogue tracks the schedule and publishes each event's status changes
+type Catalogue struct {
+	cfg      *config.Config
+	provider events.Provider
+	bus      bus.Bus
+	store    storage.EventStore
+	ctx      context.Context
+	logger   *slog.Logger
+	events   map[string]*models.Event
+}
+
+// NewCatalogue creates a catalogue reading the schedule from provider,
+// persisting to store and publishing lifecycle changes to b
+func NewCatalogue(cfg *config.Config, provider events.Provider, b bus.Bus, store storage.EventStore) *Catalogue {
+	return &Catalogue{
+		cfg:      cfg,
+		provider: provider,
+		bus:      b,
+		store:    store,
+		ctx:      bus.WithProducer(context.Background(), "catalogue"),
+		logger:   slog.With("component", "catalogue", "provider", provider.Name()),
+		events:   make(map[string]*models.Event),
+	}
+}
+
+// Run keeps the catalogue in sync until ctx is cancelled
+func (c *Catalogue) Run(ctx context.Context) {
+	c.logger.Info("Starting event catalogue")
+
+	// Pick up where we left off so statuses never move backwards
+	existing, err := c.store.ListEvents(c.ctx)
+	if err != nil {
+		c.logger.Error("Error loading events", "error", err)
+	}
+	now := time.Now()
+	for i := range existing {
+		if !expired(&existing[i], now) {
+			c.events[existing[i].ID] = &existing[i]
+		}
+	}
+	c.logger.Info("Loaded events from the store", "events", len(c.events))
+
+	syncTicker := time.NewTicker(c.cfg.Catalogue.SyncInterval.Duration)
+	defer syncTicker.Stop()
+
+	// Statuses are checked far more often than the schedule is re-read
+	statusTicker := time.NewTicker(c.cfg.Catalogue.StatusInterval.Duration)
+	defer statusTicker.Stop()
+
+	// Initial sync
+	c.syncSchedule()
+	c.advanceStatuses()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncTicker.C:
+			c.syncSchedule()
+		case <-statusTicker.C:
+			c.advanceStatuses()
+		}
+	}
+}
+
+// syncSchedule merges the provider's schedule into the catalogue
+func (c *Catalogue) syncSchedule() {
+	schedule, err := c.provider.Schedule(c.ctx)
+	if err != nil {
+		c.logger.Error("Error fetching schedule", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range schedule {
+		incoming := schedule[i]
+
+		existing, ok := c.events[incoming.ID]
+		if !ok {
+			// Don't bring back an event that has been evicted
+			if expired(&incoming, now) {
+				continue
+			}
+
+			// Trust the provider's status; advanceStatuses moves it on from there
+			if incoming.Status == "" {
+				incoming.Status = models.EventStatusUpcoming
+			}
+			c.events[incoming.ID] = &incoming
+			c.persist(&incoming)
+			c.publish(&incoming, "")
+			continue
+		}
+
+		// Keep our status unless the provider reports one further along
+		status := existing.Status
+		if events.CanTransition(status, incoming.Status) {
+			status = incoming.Status
+		}
+		previous := existing.Status
+
+		*existing = incoming
+		existing.Status = status
+		c.persist(existing)
+
+		if status != previous {
+			c.publish(existing, previous)
+		}
+	}
+
+	c.logger.Info("Synced scheduled events", "events", len(schedule))
+}
+
+// advanceStatuses moves events along as their start and end times pass and
+// evicts final events past retention
+func (c *Catalogue) advanceStatuses() {
+	now := time.Now()
+	evicted := 0
+
+	for id, ev := range c.events {
+		if next := events.ExpectedStatus(ev, now); next != ev.Status {
+			previous := ev.Status
+			ev.Status = next
+			c.persist(ev)
+			c.publish(ev, previous)
+		}
+
+		if ev.Status == models.EventStatusFinal && expired(ev, now) {
+			delete(c.events, id)
+			evicted++
+		}
+	}
+
+	if evicted > 0 {
+		c.logger.Info("Evicted finished events", "evicted", evicted, "events", len(c.events))
+	}
+}
+
+// expired reports whether an event ended more than retention ago
+func expired(ev *models.Event, now time.Time) bool {
+	end := events.EndTime(ev)
+	return !end.IsZero() && now.Sub(end) > retention
+}
+
+func (c *Catalogue) persist(ev *models.Event) {
+	if err := c.store.UpsertEvent(c.ctx, ev); err != nil {
+		c.logger.Error("Error persisting event", "event_id", ev.ID, "error", err)
+	}
+}
+
+func (c *Catalogue) publish(ev *models.Event, previous string) {
+	msg := models.EventLifecycle{
+		EventID:        ev.ID,
+		Event:          *ev,
+		PreviousStatus: previous,
+		Status:         ev.Status,
+		Timestamp:      time.Now(),
+	}
+
+	if err := c.bus.Publish(c.ctx, c.cfg.Kafka.Topics.EventLifecycle, ev.ID, msg); err != nil {
+		c.logger.Error("Error publishing lifecycle", "event_id", ev.ID, "error", err)
+		return
+	}
+
+	c.logger.Info("Event status changed", "event_id", ev.ID, "from", previous, "to", ev.Status)
+}
@@ -0,0 +1,69 @@
+package catalogue
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+)
+
+// scheduleProvider serves a fixed schedule
+type scheduleProvider []models.Event
+
+func (p scheduleProvider) Name() string { return "fixed" }
+
+func (p scheduleProvider) Schedule(ctx context.Context) ([]models.Event, error) {
+	return append([]models.Event(nil), p...), nil
+}
+
+func TestCatalogueEvictsFinishedEvents(t *testing.T) {
+	now := time.Now()
+	game := func(id string, start time.Time) models.Event {
+		return models.Event{ID: id, Sport: "NBA", HomeTeam: "Lakers", AwayTeam: "Celtics", StartTime: start, EndTime: start.Add(150 * time.Minute)}
+	}
+	provider := scheduleProvider{
+		game("two-days-ago", now.Add(-48*time.Hour)),
+		game("earlier-today", now.Add(-4*time.Hour)),
+		game("tonight", now.Add(2*time.Hour)),
+	}
+
+	cfg := config.Default()
+	mb := bus.NewMemory(cfg.HTTP.BroadcastBuffer)
+	t.Cleanup(func() { mb.Close() })
+	c := NewCatalogue(cfg, provider, mb, storage.NewMemoryEventStore())
+
+	ids := func() []string {
+		var ids []string
+		for id := range c.events {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	want := []string{"earlier-today", "tonight"}
+
+	for _, step := range []string{"first sync", "later sync"} {
+		c.syncSchedule()
+		c.advanceStatuses()
+
+		got := ids()
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("%s: catalogue holds %v, want %v", step, got, want)
+		}
+	}
+	if status := c.events["earlier-today"].Status; status != models.EventStatusFinal {
+		t.Errorf("earlier-today is %s, want %s", status, models.EventStatusFinal)
+	}
+
+	// A final event is evicted once it passes retention
+	c.events["earlier-today"].EndTime = now.Add(-retention - time.Minute)
+	c.advanceStatuses()
+	if got := ids(); len(got) != 1 || got[0] != "tonight" {
+		t.Errorf("catalogue holds %v, want [tonight]", got)
+	}
+}
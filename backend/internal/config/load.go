@@ -0,0 +1,267 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written as "30s" in YAML, env and flags
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalYAML parses a Go duration string
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// MarshalYAML prints the duration the way it is written
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// MarshalJSON prints the duration as a string, e.g. "30s"
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON parses a Go duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// ErrPrintedConfig is returned by Load once it has printed the config for
+// -print-config, which the caller should exit on
+var ErrPrintedConfig = errors.New("config printed")
+
+// Load builds a service's effective configuration. Defaults are overlaid by
+// the YAML file (-config or CONFIG_FILE), then env variables, then flags.
+// With -print-config the result is printed and ErrPrintedConfig returned.
+func Load(service string, args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet(service, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	printConfig := fs.Bool("print-config", false, "print the effective config and exit")
+	for _, leaf := range leaves(cfg) {
+		fs.String(leaf.path, "", fmt.Sprintf("overrides %s (env %s)", leaf.path, leaf.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", *configFile, err)
+		}
+	}
+
+	byPath := make(map[string]leaf)
+	for _, leaf := range leaves(cfg) {
+		byPath[leaf.path] = leaf
+
+		if v := os.Getenv(leaf.env); v != "" {
+			if err := leaf.set(v); err != nil {
+				return nil, fmt.Errorf("env %s: %w", leaf.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if leaf, ok := byPath[f.Name]; ok && flagErr == nil {
+			if err := leaf.set(f.Value.String()); err != nil {
+				flagErr = fmt.Errorf("flag -%s: %w", f.Name, err)
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(service); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if *printConfig {
+		fmt.Print(cfg)
+		return nil, ErrPrintedConfig
+	}
+
+	return cfg, nil
+}
+
+// String renders the config as YAML with credentials redacted
+func (c *Config) String() string {
+	redacted := c.redacted()
+	data, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return fmt.Sprintf("unprintable config: %v", err)
+	}
+	return string(data)
+}
+
+// LogValue logs the config as one group per section, keyed by YAML name,
+// with credentials redacted
+func (c *Config) LogValue() slog.Value {
+	redacted := c.redacted()
+	return slog.GroupValue(logAttrs(reflect.ValueOf(redacted))...)
+}
+
+func (c *Config) redacted() Config {
+	redacted := *c
+	if u, err := url.Parse(c.Postgres.URL); err == nil {
+		redacted.Postgres.URL = u.Redacted()
+	}
+	return redacted
+}
+
+func logAttrs(v reflect.Value) []slog.Attr {
+	var attrs []slog.Attr
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			attrs = append(attrs, slog.Attr{Key: name, Value: slog.GroupValue(logAttrs(fv)...)})
+			continue
+		}
+		attrs = append(attrs, slog.Any(name, fv.Interface()))
+	}
+	return attrs
+}
+
+// leaf is a scalar setting addressable by YAML path and env variable
+type leaf struct {
+	path  string
+	env   string
+	value reflect.Value
+}
+
+var durationType = reflect.TypeOf(Duration{})
+
+// leaves walks the config struct collecting every scalar setting. Maps are
+// only settable from the file.
+func leaves(cfg *Config) []leaf {
+	var out []leaf
+
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+
+			path := name
+			if prefix != "" {
+				path = prefix + "." + name
+			}
+
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+				walk(fv, path)
+				continue
+			}
+			if fv.Kind() == reflect.Map {
+				continue
+			}
+
+			env := field.Tag.Get("env")
+			if env == "" {
+				env = strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+			}
+			out = append(out, leaf{path: path, env: env, value: fv})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+
+	return out
+}
+
+func (l leaf) set(raw string) error {
+	v := l.value
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(Duration{d}))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv blanks the env variables of every setting, which Load treats
+// as unset, so the tests don't pick up the environment they run in
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	for _, leaf := range leaves(Default()) {
+		t.Setenv(leaf.env, "")
+	}
+}
+
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayering(t *testing.T) {
+	const file = `
+kafka:
+    brokers: [file:9092]
+redis:
+    odds_ttl: 1m
+http:
+    port: "9000"
+detector:
+    min_profit: 1.5
+fetcher:
+    intervals:
+        bookA: 10s
+`
+
+	tests := []struct {
+		name       string
+		file       string
+		fileViaEnv bool
+		env        map[string]string
+		args       []string
+		want       func(cfg *Config) // applied to the defaults
+	}{
+		{
+			name: "defaults",
+			want: func(cfg *Config) {},
+		},
+		{
+			name: "file over defaults, maps merged",
+			file: file,
+			want: func(cfg *Config) {
+				cfg.Kafka.Brokers = []string{"file:9092"}
+				cfg.Redis.OddsTTL = Duration{time.Minute}
+				cfg.HTTP.Port = "9000"
+				cfg.Detector.MinProfit = 1.5
+				cfg.Fetcher.Intervals["bookA"] = Duration{10 * time.Second}
+			},
+		},
+		{
+			name:       "file named by CONFIG_FILE",
+			file:       "http:\n    port: \"9000\"\n",
+			fileViaEnv: true,
+			want: func(cfg *Config) {
+				cfg.HTTP.Port = "9000"
+			},
+		},
+		{
+			name: "env over file",
+			file: file,
+			env:  map[string]string{"PORT": "9100", "REDIS_ODDS_TTL": "45s"},
+			want: func(cfg *Config) {
+				cfg.Kafka.Brokers = []string{"file:9092"}
+				cfg.Redis.OddsTTL = Duration{45 * time.Second}
+				cfg.HTTP.Port = "9100"
+				cfg.Detector.MinProfit = 1.5
+				cfg.Fetcher.Intervals["bookA"] = Duration{10 * time.Second}
+			},
+		},
+		{
+			name: "flags over env",
+			file: file,
+			env:  map[string]string{"PORT": "9100", "MIN_PROFIT": "2"},
+			args: []string{"-http.port", "9200", "-redis.odds_ttl=5s"},
+			want: func(cfg *Config) {
+				cfg.Kafka.Brokers = []string{"file:9092"}
+				cfg.Redis.OddsTTL = Duration{5 * time.Second}
+				cfg.HTTP.Port = "9200"
+				cfg.Detector.MinProfit = 2
+				cfg.Fetcher.Intervals["bookA"] = Duration{10 * time.Second}
+			},
+		},
+		{
+			name: "lists are comma separated",
+			env:  map[string]string{"KAFKA_BROKERS": "a:9092, b:9092,"},
+			want: func(cfg *Config) {
+				cfg.Kafka.Brokers = []string{"a:9092", "b:9092"}
+			},
+		},
+		{
+			name: "ints and bools",
+			env:  map[string]string{"LIVE_MODE": "true"},
+			args: []string{"-startup.max_attempts", "3", "-kafka.consumer.max_deliveries", "2"},
+			want: func(cfg *Config) {
+				cfg.Detector.LiveMode = true
+				cfg.Startup.MaxAttempts = 3
+				cfg.Kafka.Consumer.MaxDeliveries = 2
+			},
+		},
+		{name: "missing file", args: []string{"-config", "/nonexistent/config.yaml"}},
+		{name: "unknown field in file", file: "http:\n    prot: \"9000\"\n"},
+		{name: "bad env duration", env: map[string]string{"REDIS_ODDS_TTL": "soon"}},
+		{name: "bad flag int", args: []string{"-startup.max_attempts", "many"}},
+		{name: "bad env bool", env: map[string]string{"LIVE_MODE": "sometimes"}},
+		{name: "unknown flag", args: []string{"-http.prot", "9000"}},
+		{name: "invalid after layering", args: []string{"-kafka.encoding", "xml"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				path := writeConfig(t, tt.file)
+				if tt.fileViaEnv {
+					t.Setenv("CONFIG_FILE", path)
+				} else {
+					args = append([]string{"-config", path}, args...)
+				}
+			}
+
+			got, err := Load("api", args)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("Load() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load(): %v", err)
+			}
+
+			want := Default()
+			tt.want(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Load() = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestConfigRedactsPassword(t *testing.T) {
+	cfg := Default()
+	cfg.Postgres.URL = "postgresql://user:secret@db:5432/app"
+
+	if s := cfg.String(); !strings.Contains(s, "user:xxxxx@db") || strings.Contains(s, "secret") {
+		t.Errorf("String() doesn't redact the password:\n%s", s)
+	}
+	if cfg.Postgres.URL != "postgresql://user:secret@db:5432/app" {
+		t.Errorf("String() changed the config")
+	}
+}
+
+func TestLoadPrintConfig(t *testing.T) {
+	clearEnv(t)
+
+	// Capture what Load prints
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	cfg, err := Load("api", []string{"-print-config", "-http.port", "9000"})
+	os.Stdout = stdout
+	w.Close()
+	printed, _ := io.ReadAll(r)
+
+	if !errors.Is(err, ErrPrintedConfig) {
+		t.Fatalf("Load() error = %v, want ErrPrintedConfig", err)
+	}
+	if cfg != nil {
+		t.Errorf("Load() returned a config along with ErrPrintedConfig")
+	}
+	if !strings.Contains(string(printed), `port: "9000"`) {
+		t.Errorf("Load() printed:\n%s\nwant the effective config", printed)
+	}
+}
+
+func TestValidateCacheRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		adjust  func(cfg *Config)
+		wantErr string
+	}{
+		{name: "defaults", adjust: func(cfg *Config) {}},
+		{
+			name: "below prematch_max_age",
+			adjust: func(cfg *Config) {
+				cfg.Detector.PreMatchMaxAge = Duration{2 * time.Minute}
+			},
+			wantErr: "detector.prematch_max_age (2m0s)",
+		},
+		{
+			name: "below a pre-match market window",
+			adjust: func(cfg *Config) {
+				cfg.Detector.PreMatchMarkets["spread"] = Duration{2 * time.Minute}
+			},
+			wantErr: "detector.prematch_markets.spread",
+		},
+		{
+			name: "below live_max_age",
+			adjust: func(cfg *Config) {
+				cfg.Detector.LiveMaxAge = Duration{2 * time.Minute}
+			},
+			wantErr: "detector.live_max_age",
+		},
+		{
+			name: "below a live market window",
+			adjust: func(cfg *Config) {
+				cfg.Detector.LiveMarkets["total"] = Duration{2 * time.Minute}
+			},
+			wantErr: "detector.live_markets.total",
+		},
+		{
+			name: "below a book's fetch interval",
+			adjust: func(cfg *Config) {
+				cfg.Fetcher.Intervals["slowbook"] = Duration{2 * time.Minute}
+			},
+			wantErr: "fetcher.intervals.slowbook",
+		},
+		{
+			name: "at the longest window",
+			adjust: func(cfg *Config) {
+				cfg.Detector.LiveMarkets["total"] = Duration{2 * time.Minute}
+				cfg.Detector.CacheRetention = Duration{2 * time.Minute}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.adjust(cfg)
+			err := cfg.Validate("detector")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate(): %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
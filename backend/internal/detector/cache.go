@@ -0,0 +1,236 @@
+package detector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// oddsIndex holds every book's latest quote, indexed by event, market and
+// book. Each event has its own lock, so updates for different events are
+// processed in parallel; the index lock is only taken to find, add or
+// remove an event, and never held while waiting on an event's lock.
+type oddsIndex struct {
+	mu     sync.RWMutex
+	events map[string]*eventOdds
+}
+
+// eventOdds is one event's quotes and lifecycle state. Its lock is held for
+// the whole of processing an update for the event.
+type eventOdds struct {
+	mu        sync.Mutex
+	partition int // the bus partition the event's messages arrive on
+	live      bool
+	droppedAt time.Time                                // set once the event is no longer tracked
+	markets   map[string]map[string]*models.OddsUpdate // market to book to latest quote
+	removed   bool                                     // pruned from the index, look it up again
+
+	// Opportunities published as open and not yet closed, by ID
+	opportunities map[string]*models.ArbitrageOpportunity
+}
+
+func newOddsIndex() *oddsIndex {
+	return &oddsIndex{events: make(map[string]*eventOdds)}
+}
+
+// lock returns the event's entry, created if needed, with its lock held
+func (x *oddsIndex) lock(eventID string, partition int) *eventOdds {
+	for {
+		ev := x.event(eventID, partition)
+		ev.mu.Lock()
+		if !ev.removed {
+			return ev
+		}
+		// Pruned between the lookup and the lock
+		ev.mu.Unlock()
+	}
+}
+
+func (x *oddsIndex) event(eventID string, partition int) *eventOdds {
+	x.mu.RLock()
+	ev, ok := x.events[eventID]
+	x.mu.RUnlock()
+	if ok {
+		return ev
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if ev, ok = x.events[eventID]; !ok {
+		ev = &eventOdds{
+			partition:     partition,
+			markets:       make(map[string]map[string]*models.OddsUpdate),
+			opportunities: make(map[string]*models.ArbitrageOpportunity),
+		}
+		x.events[eventID] = ev
+	}
+	return ev
+}
+
+// prune drops quotes older than retention, then removes events left with
+// nothing worth keeping. Dropped events are remembered for dropRetention
+// so late quotes for them are still ignored.
+func (x *oddsIndex) prune(now time.Time, retention, dropRetention time.Duration) {
+	for id, ev := range x.all() {
+		ev.mu.Lock()
+		for market, books := range ev.markets {
+			for book, odds := range books {
+				if now.Sub(odds.Timestamp) > retention {
+					delete(books, book)
+				}
+			}
+			if len(books) == 0 {
+				delete(ev.markets, market)
+			}
+		}
+		idle := ev.idle(now, dropRetention)
+		ev.mu.Unlock()
+
+		if idle {
+			x.remove(id, ev, now, dropRetention)
+		}
+	}
+}
+
+// all returns a copy of the index, so events can be visited one lock at a time
+func (x *oddsIndex) all() map[string]*eventOdds {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	events := make(map[string]*eventOdds, len(x.events))
+	for id, ev := range x.events {
+		events[id] = ev
+	}
+	return events
+}
+
+// remove deletes an idle event unless it picked up quotes meanwhile. Once
+// marked removed nothing can pick it up, so it's deleted from the index
+// after its lock is released.
+func (x *oddsIndex) remove(eventID string, ev *eventOdds, now time.Time, dropRetention time.Duration) {
+	ev.mu.Lock()
+	if ev.removed || !ev.idle(now, dropRetention) {
+		ev.mu.Unlock()
+		return
+	}
+	ev.removed = true
+	ev.mu.Unlock()
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.events[eventID] == ev {
+		delete(x.events, eventID)
+	}
+}
+
+// idle reports whether the event holds nothing worth keeping. Caller holds ev.mu.
+func (ev *eventOdds) idle(now time.Time, dropRetention time.Duration) bool {
+	if len(ev.markets) > 0 || len(ev.opportunities) > 0 || ev.live {
+		return false
+	}
+	return ev.droppedAt.IsZero() || now.Sub(ev.droppedAt) > dropRetention
+}
+
+// quote returns a book's latest quote in a market. Caller holds ev.mu.
+func (ev *eventOdds) quote(market, book string) (*models.OddsUpdate, bool) {
+	odds, ok := ev.markets[market][book]
+	return odds, ok
+}
+
+// set stores odds as its book's latest quote in its market. Caller holds ev.mu.
+func (ev *eventOdds) set(odds *models.OddsUpdate) {
+	books, ok := ev.markets[odds.MarketType]
+	if !ok {
+		books = make(map[string]*models.OddsUpdate)
+		ev.markets[odds.MarketType] = books
+	}
+	books[odds.Bookmaker] = odds
+}
+
+// unset forgets a book's quote in a market. Caller holds ev.mu.
+func (ev *eventOdds) unset(market, book string) {
+	books := ev.markets[market]
+	delete(books, book)
+	if len(books) == 0 {
+		delete(ev.markets, market)
+	}
+}
+
+// clear drops every quote and returns how many there were. Caller holds ev.mu.
+func (ev *eventOdds) clear() int {
+	dropped := 0
+	for _, books := range ev.markets {
+		dropped += len(books)
+	}
+	ev.markets = make(map[string]map[string]*models.OddsUpdate)
+	return dropped
+}
+
+// eventSnapshot is an event's state as saved for the next owner of its
+// partition
+type eventSnapshot struct {
+	Live          bool                           `json:"live,omitempty"`
+	DroppedAt     time.Time                      `json:"dropped_at,omitempty"`
+	Quotes        []*models.OddsUpdate           `json:"quotes,omitempty"`
+	Opportunities []*models.ArbitrageOpportunity `json:"opportunities,omitempty"`
+}
+
+// take removes a partition's events from the index and returns them. An
+// update holding an event's lock when it's taken is in its snapshot.
+func (x *oddsIndex) take(partition int) map[string]eventSnapshot {
+	x.mu.Lock()
+	taken := make(map[string]*eventOdds)
+	for id, ev := range x.events {
+		if ev.partition == partition {
+			taken[id] = ev
+			delete(x.events, id)
+		}
+	}
+	x.mu.Unlock()
+
+	snapshots := make(map[string]eventSnapshot, len(taken))
+	for id, ev := range taken {
+		ev.mu.Lock()
+		snapshot := eventSnapshot{Live: ev.live, DroppedAt: ev.droppedAt}
+		for _, books := range ev.markets {
+			for _, odds := range books {
+				snapshot.Quotes = append(snapshot.Quotes, odds)
+			}
+		}
+		for _, arb := range ev.opportunities {
+			snapshot.Opportunities = append(snapshot.Opportunities, arb)
+		}
+		ev.removed = true
+		ev.mu.Unlock()
+
+		snapshots[id] = snapshot
+	}
+	return snapshots
+}
+
+// restore adds an event taken by a previous owner. Quotes and open
+// opportunities already held for the event win over the snapshot's unless
+// the snapshot's are newer, and a dropped event takes none.
+func (x *oddsIndex) restore(eventID string, partition int, snapshot eventSnapshot) {
+	ev := x.lock(eventID, partition)
+	defer ev.mu.Unlock()
+
+	ev.live = ev.live || snapshot.Live
+	if ev.droppedAt.IsZero() {
+		ev.droppedAt = snapshot.DroppedAt
+	}
+	if !ev.droppedAt.IsZero() {
+		return
+	}
+	for _, odds := range snapshot.Quotes {
+		if current, ok := ev.quote(odds.MarketType, odds.Bookmaker); !ok || odds.Timestamp.After(current.Timestamp) {
+			ev.set(odds)
+		}
+	}
+	for _, arb := range snapshot.Opportunities {
+		if current, ok := ev.opportunities[arb.ID]; !ok || arb.UpdatedAt.After(current.UpdatedAt) {
+			ev.opportunities[arb.ID] = arb
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/arbitrage"
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/normalizer"
+	"github.com/matthewhu/sportarbitrage/internal/startup"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+	"github.com/matthewhu/sportarbitrage/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Detector pairs each odds update with the other books' latest quotes for
+// the same event and publishes any arbitrage it finds
+type Detector struct {
+	cfg      *config.Config
+	bus      bus.Bus
+	state    storage.DetectorStateStore // runtime params and partition handover
+	quotes   storage.OddsStore          // the fetchers' cached quotes
+	store    storage.OpportunityStore   // open opportunities, read by the API
+	params   atomic.Pointer[activeParams]
+	audit    *auditLog
+	liveMode bool // keep detecting once events go in-play
+	ctx      context.Context
+	logger   *slog.Logger
+	odds     *oddsIndex
+	rules    *normalizer.Rules // canonicalizes quotes read back from the fetchers' cache
+	wg       sync.WaitGroup
+}
+
+// NewDetector creates a detector reading odds from and publishing
+// arbitrage to b, warming its cache from quotes and keeping open
+// opportunities in store. state holds runtime params and the state handed
+// over between replicas.
+func NewDetector(cfg *config.Config, b bus.Bus, state storage.DetectorStateStore, quotes storage.OddsStore, store storage.OpportunityStore) *Detector {
+	d := &Detector{
+		cfg:      cfg,
+		bus:      b,
+		state:    state,
+		quotes:   quotes,
+		store:    store,
+		audit:    &auditLog{},
+		liveMode: cfg.Detector.LiveMode,
+		ctx:      bus.WithProducer(context.Background(), "detector"),
+		logger:   slog.With("component", "detector"),
+		odds:     newOddsIndex(),
+		rules:    normalizer.NewRules(cfg.Normalizer),
+	}
+
+	// Start from the configured params, runtime overrides are applied by watchParams
+	if err := d.setParams(defaultParams(cfg.Detector), "config"); err != nil {
+		telemetry.Fatal("Invalid detector params", "error", err)
+	}
+
+	return d
+}
+
+// Run consumes odds until ctx is cancelled and returns once every
+// background loop has stopped. Messages already delivered are processed
+// to completion on d.ctx, which outlives ctx by the shutdown timeout.
+//
+// Replicas share the odds and lifecycle partitions between them. Each
+// keeps state only for the events of the partitions it owns, loading it
+// from the state store when a partition is assigned and saving it when revoked.
+// An assignment also picks up the quotes the fetchers cached, so
+// a restarted replica finds arbitrage on the first update it consumes.
+func (d *Detector) Run(ctx context.Context) {
+	d.logger.Info("Starting arbitrage detector", "live_mode", d.liveMode)
+	d.ctx = bus.WithProducer(startup.DrainContext(ctx, d.cfg.HTTP.ShutdownTimeout.Duration), "detector")
+
+	topics, groups := d.cfg.Kafka.Topics, d.cfg.Kafka.Groups
+
+	// Start cache cleanup routine
+	d.wg.Add(1)
+	go d.cleanupOldOdds(ctx)
+
+	// Close opportunities whose prices are gone
+	d.wg.Add(1)
+	go d.sweepOpportunities(ctx)
+
+	// Pick up param changes without a restart
+	if d.cfg.Detector.ParamsFile != "" || d.cfg.Detector.ParamsRedisKey != "" {
+		d.wg.Add(1)
+		go d.watchParams(ctx)
+	}
+
+	// Odds arrive already validated and canonicalized by the normalizer.
+	// Lifecycle messages share their partitioning, so an event's status
+	// changes reach the replica holding its odds.
+	owned := []string{topics.OddsProcessed, topics.EventLifecycle}
+	if err := d.bus.SubscribeOwned(ctx, groups.Detector, owned, d.handle, partitionOwner{d}); err != nil {
+		d.logger.Error("Odds subscription ended", "error", err)
+	}
+
+	d.wg.Wait()
+}
+
+func (d *Detector) handle(ctx context.Context, msg bus.Message) {
+	if msg.Topic == d.cfg.Kafka.Topics.EventLifecycle {
+		d.handleLifecycle(ctx, msg)
+		return
+	}
+	d.handleOdds(ctx, msg)
+}
+
+// handleOdds acks an update only once its opportunities are published and
+// stored, so a failure leaves it to be delivered again
+func (d *Detector) handleOdds(ctx context.Context, msg bus.Message) {
+	// Spans and publishes use d.ctx so in-flight work survives shutdown
+	spanCtx, span := bus.StartConsume(d.ctx, msg)
+	defer span.End()
+
+	// Parse odds update
+	var odds models.OddsUpdate
+	if err := msg.Decode(&odds); err != nil {
+		bus.DeadLetter(ctx, d.bus, "detector", msg, fmt.Errorf("failed to parse odds: %w", err))
+		return
+	}
+	if err := odds.Validate(); err != nil {
+		bus.DeadLetter(ctx, d.bus, "detector", msg, fmt.Errorf("invalid odds: %w", err))
+		return
+	}
+
+	// Process odds immediately for real-time detection
+	if err := d.processOdds(spanCtx, msg.Partition, &odds); err != nil {
+		d.logger.ErrorContext(spanCtx, "Error processing odds", append(msg.LogAttrs(),
+			"event_id", odds.EventID, "book", odds.Bookmaker, "error", err)...)
+		span.RecordError(err)
+		return
+	}
+
+	d.ack(ctx, msg)
+}
+
+func (d *Detector) ack(ctx context.Context, msg bus.Message) {
+	if err := d.bus.Ack(ctx, msg); err != nil {
+		d.logger.ErrorContext(ctx, "Error acking message", append(msg.LogAttrs(), "error", err)...)
+	}
+}
+
+func (d *Detector) handleLifecycle(ctx context.Context, msg bus.Message) {
+	var lifecycle models.EventLifecycle
+	if err := msg.Decode(&lifecycle); err != nil {
+		bus.DeadLetter(ctx, d.bus, "detector", msg, fmt.Errorf("failed to parse lifecycle: %w", err))
+		return
+	}
+	if err := lifecycle.Validate(); err != nil {
+		bus.DeadLetter(ctx, d.bus, "detector", msg, fmt.Errorf("invalid lifecycle: %w", err))
+		return
+	}
+
+	var err error
+	switch lifecycle.Status {
+	case models.EventStatusLive:
+		if d.liveMode {
+			err = d.markLive(lifecycle.EventID, msg.Partition)
+		} else {
+			err = d.dropEvent(lifecycle.EventID, msg.Partition)
+		}
+	case models.EventStatusFinal:
+		err = d.dropEvent(lifecycle.EventID, msg.Partition)
+	}
+
+	// Left unacked, the change is applied again and the rest closed then
+	if err != nil {
+		d.logger.ErrorContext(ctx, "Error closing event's arbitrage", append(msg.LogAttrs(),
+			"event_id", lifecycle.EventID, "error", err)...)
+		return
+	}
+	d.ack(ctx, msg)
+}
+
+// markLive switches an event to in-play detection. Cached pre-match
+// quotes are discarded so they are never paired with live prices, and
+// the opportunities they made are closed.
+func (d *Detector) markLive(eventID string, partition int) error {
+	ev := d.odds.lock(eventID, partition)
+	defer ev.mu.Unlock()
+
+	ev.live = true
+	dropped := ev.clear()
+
+	d.logger.Info("Event is live, discarded pre-match markets", "event_id", eventID, "dropped", dropped)
+	return d.closeAll(d.ctx, ev, models.CloseReasonEventLive)
+}
+
+// dropEvent forgets an event's markets and closes its opportunities once
+// it is no longer tradeable
+func (d *Detector) dropEvent(eventID string, partition int) error {
+	ev := d.odds.lock(eventID, partition)
+	defer ev.mu.Unlock()
+
+	ev.droppedAt = time.Now()
+	ev.live = false
+	dropped := ev.clear()
+
+	d.logger.Info("Event is no longer tracked, dropped cached markets", "event_id", eventID, "dropped", dropped)
+	return d.closeAll(d.ctx, ev, models.CloseReasonEventEnded)
+}
+
+// processOdds caches an update and checks it against every other book's
+// latest quote for the same event and market, opening, updating or closing
+// the opportunities that involve the update's book. Only the event is
+// locked, so updates for other events proceed in parallel. Redelivered or
+// out-of-order updates that are not newer than the cached quote are
+// skipped, and an opportunity already open is only published again when
+// its profit changes, so processing an update twice has no new effect.
+func (d *Detector) processOdds(ctx context.Context, partition int, newOdds *models.OddsUpdate) (err error) {
+	ctx, span := telemetry.Start(ctx, "calculate arbitrage", trace.WithAttributes(
+		attribute.String("event.id", newOdds.EventID),
+		attribute.String("sportsbook", newOdds.Bookmaker),
+	))
+	defer func() { telemetry.End(span, err) }()
+
+	start := time.Now()
+	defer func() { metrics.DetectionDuration.Observe(time.Since(start).Seconds()) }()
+
+	ev := d.odds.lock(newOdds.EventID, partition)
+	defer ev.mu.Unlock()
+
+	// Ignore events that have started (outside live mode) or finished
+	if !ev.droppedAt.IsZero() {
+		return nil
+	}
+
+	// Read the params once so a reload can't change them mid-update
+	params := d.params.Load()
+	if !params.sportEnabled(newOdds.Sport) || !params.bookEnabled(newOdds.Bookmaker) {
+		return nil
+	}
+
+	live := ev.live
+
+	previous, seen := ev.quote(newOdds.MarketType, newOdds.Bookmaker)
+	if seen && !newOdds.Timestamp.After(previous.Timestamp) {
+		return nil
+	}
+
+	// Update cache
+	ev.set(newOdds)
+
+	var firstErr error
+	now := time.Now()
+	found := make(map[string]bool)     // opportunities this update kept open
+	evaluated := make(map[string]bool) // books this update was paired with
+
+	// Check for arbitrage against all other bookmakers for the same market
+	for book, cachedOdds := range ev.markets[newOdds.MarketType] {
+		if book == newOdds.Bookmaker {
+			continue
+		}
+
+		// Check if odds are within the pair's freshness window
+		maxAge := params.freshness.MaxAge(newOdds.MarketType, live, newOdds.Bookmaker, book)
+		if now.Sub(cachedOdds.Timestamp) > maxAge || !params.bookEnabled(cachedOdds.Bookmaker) {
+			continue
+		}
+		evaluated[book] = true
+
+		// Detect arbitrage opportunity
+		arb := params.calculator.DetectArbitrage(newOdds, cachedOdds)
+		if arb == nil || arb.ProfitPercent < params.minProfitFor(arb.Sport) {
+			continue
+		}
+		arb.MarketType = newOdds.MarketType
+		arb.ID = opportunityID(arb)
+		arb.Status = models.OpportunityActive
+		arb.Live = live
+		arb.Confidence = arbitrage.Confidence(newOdds.Timestamp, cachedOdds.Timestamp, maxAge)
+		arb.UpdatedAt = arb.CreatedAt
+		arb.ExpiresAt = arb.CreatedAt.Add(params.freshness.Expiry(live))
+		found[arb.ID] = true
+
+		// Publish to Kafka for real-time notification and store for API access
+		if err := d.track(ctx, ev, arb); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// Close what the new price ended: open opportunities with this book as
+	// a leg whose pair was checked again and is no longer profitable. Pairs
+	// skipped as stale are left to the sweep.
+	for id, open := range ev.opportunities {
+		if open.MarketType != newOdds.MarketType || found[id] {
+			continue
+		}
+		other := open.BookmakerAway
+		if other == newOdds.Bookmaker {
+			other = open.BookmakerHome
+		} else if open.BookmakerHome != newOdds.Bookmaker {
+			continue
+		}
+		if other != newOdds.Bookmaker && !evaluated[other] {
+			continue
+		}
+		if err := d.close(ctx, ev, open, models.CloseReasonPricesMoved, now); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// Forget the update so its redelivery is processed again
+	if firstErr != nil {
+		if seen {
+			ev.set(previous)
+		} else {
+			ev.unset(newOdds.MarketType, newOdds.Bookmaker)
+		}
+	}
+
+	return firstErr
+}
+
+// bookPair labels an opportunity by its two books, in a fixed order
+func bookPair(arb *models.ArbitrageOpportunity) string {
+	books := []string{arb.BookmakerHome, arb.BookmakerAway}
+	sort.Strings(books)
+	return books[0] + "+" + books[1]
+}
+
+func (d *Detector) storeArbitrage(ctx context.Context, arb *models.ArbitrageOpportunity) (err error) {
+	ctx, span := telemetry.Start(ctx, "store arbitrage", trace.WithAttributes(
+		attribute.String("arbitrage.id", arb.ID),
+	))
+	defer func() { telemetry.End(span, err) }()
+
+	// Safe to repeat, a redelivered update stores the same state
+	return d.store.SaveOpportunity(ctx, arb)
+}
+
+func (d *Detector) cleanupOldOdds(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.cfg.Detector.CleanupInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.odds.prune(time.Now(), d.cfg.Detector.CacheRetention.Duration, dropRetention)
+
+		// Opportunities whose owner died before closing them expire on
+		// their own, this drops them from the store's index
+		pruned, err := d.store.PruneOpportunities(ctx)
+		if err != nil {
+			d.logger.Warn("Error pruning expired opportunities", "error", err)
+		} else if pruned > 0 {
+			d.logger.Debug("Pruned expired opportunities", "opportunities", pruned)
+		}
+	}
+}
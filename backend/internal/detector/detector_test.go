@@ -0,0 +1,154 @@
+package detector
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+)
+
+// benchEvent is the fixed part of an event's quotes
+type benchEvent struct {
+	id   string
+	home string
+	away string
+	prob float64 // fair probability of a home win
+}
+
+// benchFeed generates the quotes books pricing a catalogue of events with
+// the same margin would send, walking the books across all events so
+// consecutive updates mostly touch different events as a real feed would
+type benchFeed struct {
+	events []benchEvent
+	books  []string
+	margin float64 // bookmaker overround; lower finds more arbitrage
+}
+
+func newBenchFeed(events, books int, margin float64) *benchFeed {
+	rng := rand.New(rand.NewSource(1))
+	f := &benchFeed{events: make([]benchEvent, events), books: make([]string, books), margin: margin}
+	for i := range f.events {
+		f.events[i] = benchEvent{
+			id:   "event-" + strconv.Itoa(i),
+			home: "Home " + strconv.Itoa(i),
+			away: "Away " + strconv.Itoa(i),
+			prob: 0.3 + rng.Float64()*0.4,
+		}
+	}
+	for i := range f.books {
+		f.books[i] = "book-" + strconv.Itoa(i)
+	}
+	return f
+}
+
+// update returns the feed's ith update. Each book prices the fair odds
+// with its margin and a little noise.
+func (f *benchFeed) update(i int, rng *rand.Rand) *models.OddsUpdate {
+	ev := f.events[i%len(f.events)]
+	noise := 1 + rng.NormFloat64()*0.01
+	return &models.OddsUpdate{
+		ID:         strconv.Itoa(i),
+		EventID:    ev.id,
+		Sport:      "NBA",
+		HomeTeam:   ev.home,
+		AwayTeam:   ev.away,
+		Bookmaker:  f.books[(i/len(f.events))%len(f.books)],
+		HomeOdds:   noise / (ev.prob * f.margin),
+		AwayOdds:   (2 - noise) / ((1 - ev.prob) * f.margin),
+		Timestamp:  time.Now(),
+		MarketType: "moneyline",
+	}
+}
+
+// newBenchDetector creates a detector on in-memory stores and bus, with
+// logging off so per-update lines don't swamp the numbers
+func newBenchDetector(b *testing.B) (*Detector, *storage.MemoryOpportunityStore) {
+	b.Helper()
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	b.Cleanup(func() { slog.SetDefault(logger) })
+
+	cfg := config.Default()
+	mb := bus.NewMemory(cfg.HTTP.BroadcastBuffer)
+	b.Cleanup(func() { mb.Close() })
+
+	opportunities := storage.NewMemoryOpportunityStore()
+	d := NewDetector(cfg, mb, storage.NewMemoryDetectorStateStore(),
+		storage.NewMemoryOddsStore(cfg.Redis.OddsTTL.Duration), opportunities)
+	return d, opportunities
+}
+
+// reportOpportunities reports the opportunities left open per update
+func reportOpportunities(b *testing.B, store storage.OpportunityStore) {
+	b.Helper()
+	_, found, err := store.ActiveOpportunities(context.Background(), storage.Page{Limit: 1})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(found)/float64(b.N), "opportunities/op")
+}
+
+// BenchmarkDetectorProcess measures one update through detection, by how
+// many events are quoted, how many books quote each and how much margin
+// they price in
+func BenchmarkDetectorProcess(b *testing.B) {
+	for _, events := range []int{1000, 10000} {
+		for _, books := range []int{2, 8, 20} {
+			for _, margin := range []float64{1.05, 1.0, 0.98} {
+				name := "events=" + strconv.Itoa(events) + "/books=" + strconv.Itoa(books) +
+					"/margin=" + strconv.FormatFloat(margin, 'f', -1, 64)
+				b.Run(name, func(b *testing.B) {
+					feed := newBenchFeed(events, books, margin)
+					d, opportunities := newBenchDetector(b)
+					ctx := context.Background()
+					rng := rand.New(rand.NewSource(2))
+
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						if err := d.processOdds(ctx, 0, feed.update(i, rng)); err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.StopTimer()
+					reportOpportunities(b, opportunities)
+				})
+			}
+		}
+	}
+}
+
+// BenchmarkDetectorProcessParallel measures throughput with updates for
+// 10k events at 20 books processed on every core, as the consumer's
+// workers do
+func BenchmarkDetectorProcessParallel(b *testing.B) {
+	feed := newBenchFeed(10000, 20, 1.05)
+	d, opportunities := newBenchDetector(b)
+	ctx := context.Background()
+	var seed atomic.Int64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(seed.Add(1)))
+		i := rng.Intn(len(feed.events) * len(feed.books))
+		for pb.Next() {
+			if err := d.processOdds(ctx, 0, feed.update(i, rng)); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+	b.StopTimer()
+	reportOpportunities(b, opportunities)
+}
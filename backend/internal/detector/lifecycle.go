@@ -0,0 +1,167 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// profitTolerance is how far an open opportunity's profit, in percentage
+// points, may move before it is published again as updated
+const profitTolerance = 0.01
+
+// opportunityID names an opportunity after its event, market and legs, so
+// an arbitrage keeps one ID however often its books requote
+func opportunityID(arb *models.ArbitrageOpportunity) string {
+	name := strings.Join([]string{arb.EventID, arb.MarketType, arb.BookmakerHome, arb.BookmakerAway}, ":")
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(name)).String()
+}
+
+// track records a detected opportunity against those open for its event.
+// A new one is published as opened and one whose profit moved as updated;
+// otherwise only its stored copy is refreshed, so it stays active without
+// another message. Caller holds ev.mu.
+func (d *Detector) track(ctx context.Context, ev *eventOdds, arb *models.ArbitrageOpportunity) error {
+	open, ok := ev.opportunities[arb.ID]
+	if ok {
+		arb.CreatedAt = open.CreatedAt
+	}
+
+	publish := true
+	switch {
+	case !ok:
+		arb.Event = models.OpportunityOpened
+	case math.Abs(arb.ProfitPercent-open.ProfitPercent) >= profitTolerance:
+		arb.Event = models.OpportunityUpdated
+	default:
+		arb.Event = open.Event
+		arb.UpdatedAt = open.UpdatedAt
+		publish = false
+	}
+
+	if publish {
+		if err := d.bus.Publish(ctx, d.cfg.Kafka.Topics.ArbitrageFound, arb.EventID, arb); err != nil {
+			return fmt.Errorf("failed to publish arbitrage: %w", err)
+		}
+	}
+	if err := d.storeArbitrage(ctx, arb); err != nil {
+		return err
+	}
+	ev.opportunities[arb.ID] = arb
+	if !publish {
+		return nil
+	}
+
+	switch arb.Event {
+	case models.OpportunityOpened:
+		metrics.ArbitrageFound.WithLabelValues(arb.Sport, bookPair(arb)).Inc()
+		if fetchedAt, ok := bus.ContextFetchedAt(ctx); ok {
+			metrics.DetectionLatency.Observe(time.Since(fetchedAt).Seconds())
+		}
+		d.logger.InfoContext(ctx, "Arbitrage opened", "arb_id", arb.ID, "event_id", arb.EventID,
+			"sport", arb.Sport, "market", arb.MarketType, "home_team", arb.HomeTeam, "away_team", arb.AwayTeam,
+			"book_home", arb.BookmakerHome, "book_away", arb.BookmakerAway,
+			"profit_percent", arb.ProfitPercent, "live", arb.Live, "confidence", arb.Confidence)
+	case models.OpportunityUpdated:
+		d.logger.DebugContext(ctx, "Arbitrage updated", "arb_id", arb.ID, "event_id", arb.EventID,
+			"profit_percent", arb.ProfitPercent, "previous_profit_percent", open.ProfitPercent)
+	}
+	return nil
+}
+
+// close publishes an open opportunity's end, with why and how long it
+// lasted, and takes it out of the active set. Caller holds ev.mu.
+func (d *Detector) close(ctx context.Context, ev *eventOdds, open *models.ArbitrageOpportunity, reason string, now time.Time) error {
+	closed := *open
+	closed.Status = models.OpportunityExpired
+	closed.Event = models.OpportunityClosed
+	closed.CloseReason = reason
+	closed.UpdatedAt = now
+	closed.Lifetime = now.Sub(open.CreatedAt).Seconds()
+
+	if err := d.bus.Publish(ctx, d.cfg.Kafka.Topics.ArbitrageFound, closed.EventID, &closed); err != nil {
+		return fmt.Errorf("failed to publish closed arbitrage: %w", err)
+	}
+	if err := d.store.RemoveOpportunity(ctx, closed.ID); err != nil {
+		return err
+	}
+	delete(ev.opportunities, closed.ID)
+
+	metrics.ArbitrageLifetime.WithLabelValues(reason).Observe(closed.Lifetime)
+	d.logger.InfoContext(ctx, "Arbitrage closed", "arb_id", closed.ID, "event_id", closed.EventID,
+		"reason", reason, "lifetime_seconds", closed.Lifetime)
+	return nil
+}
+
+// closeAll closes every open opportunity of an event for the same reason.
+// Caller holds ev.mu.
+func (d *Detector) closeAll(ctx context.Context, ev *eventOdds, reason string) error {
+	now := time.Now()
+	for _, open := range ev.opportunities {
+		if err := d.close(ctx, ev, open, reason, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweepOpportunities closes open opportunities once their prices are gone:
+// a leg's quote went stale or was pruned, or nothing refreshed them before
+// they expired. Requotes close them sooner, in processOdds.
+func (d *Detector) sweepOpportunities(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.cfg.Detector.SweepInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.sweep(time.Now())
+	}
+}
+
+func (d *Detector) sweep(now time.Time) {
+	params := d.params.Load()
+
+	for _, ev := range d.odds.all() {
+		ev.mu.Lock()
+		if ev.removed {
+			// Handed over with its partition, the new owner sweeps it
+			ev.mu.Unlock()
+			continue
+		}
+		for _, open := range ev.opportunities {
+			reason := ""
+			maxAge := params.freshness.MaxAge(open.MarketType, ev.live, open.BookmakerHome, open.BookmakerAway)
+			for _, book := range []string{open.BookmakerHome, open.BookmakerAway} {
+				if odds, ok := ev.quote(open.MarketType, book); !ok || now.Sub(odds.Timestamp) > maxAge {
+					reason = models.CloseReasonStale
+				}
+			}
+			if reason == "" && now.After(open.ExpiresAt) {
+				reason = models.CloseReasonExpired
+			}
+			if reason == "" {
+				continue
+			}
+
+			// Left open on failure, the next sweep tries again
+			if err := d.close(d.ctx, ev, open, reason, now); err != nil {
+				d.logger.Error("Error closing arbitrage", "arb_id", open.ID, "event_id", open.EventID, "error", err)
+			}
+		}
+		ev.mu.Unlock()
+	}
+}
@@ -0,0 +1,131 @@
+package detector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+)
+
+func TestOpportunityID(t *testing.T) {
+	base := models.ArbitrageOpportunity{
+		EventID:       "lakers-vs-celtics",
+		MarketType:    "moneyline",
+		BookmakerHome: "booka",
+		BookmakerAway: "bookb",
+		HomeOdds:      2.2,
+		AwayOdds:      2.2,
+		ProfitPercent: 10,
+		CreatedAt:     time.Date(2026, 3, 1, 19, 0, 0, 0, time.UTC),
+	}
+	// Pinned so IDs stay the same across releases, which restarts and
+	// partition handovers rely on to match stored opportunities
+	const baseID = "712c35b8-dbde-5529-afe7-311451c2d1f8"
+
+	tests := []struct {
+		name   string
+		adjust func(a *models.ArbitrageOpportunity)
+		same   bool
+	}{
+		{name: "unchanged", adjust: func(a *models.ArbitrageOpportunity) {}, same: true},
+		{name: "requoted", adjust: func(a *models.ArbitrageOpportunity) { a.HomeOdds, a.ProfitPercent = 2.3, 12 }, same: true},
+		{name: "found later", adjust: func(a *models.ArbitrageOpportunity) { a.CreatedAt = a.CreatedAt.Add(time.Hour) }, same: true},
+		{name: "in-play", adjust: func(a *models.ArbitrageOpportunity) { a.Live = true }, same: true},
+		{name: "other event", adjust: func(a *models.ArbitrageOpportunity) { a.EventID = "lakers-vs-warriors" }},
+		{name: "other market", adjust: func(a *models.ArbitrageOpportunity) { a.MarketType = "spread" }},
+		{name: "other home book", adjust: func(a *models.ArbitrageOpportunity) { a.BookmakerHome = "bookc" }},
+		{name: "other away book", adjust: func(a *models.ArbitrageOpportunity) { a.BookmakerAway = "bookc" }},
+		{
+			name: "legs swapped",
+			adjust: func(a *models.ArbitrageOpportunity) {
+				a.BookmakerHome, a.BookmakerAway = a.BookmakerAway, a.BookmakerHome
+			},
+		},
+	}
+
+	want := opportunityID(&base)
+	if want != baseID {
+		t.Fatalf("opportunityID() = %s, want %s", want, baseID)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arb := base
+			tt.adjust(&arb)
+			if got := opportunityID(&arb); (got == want) != tt.same {
+				t.Errorf("opportunityID() = %s, base %s, want same = %v", got, want, tt.same)
+			}
+		})
+	}
+}
+
+// TestLifecycleKeepsID feeds requotes of one event through the detector and
+// checks the opportunity they make keeps its ID from opening to closing
+// and when it opens again
+func TestLifecycleKeepsID(t *testing.T) {
+	cfg := config.Default()
+	mb := bus.NewMemory(cfg.HTTP.BroadcastBuffer)
+	t.Cleanup(func() { mb.Close() })
+	opportunities := storage.NewMemoryOpportunityStore()
+	d := NewDetector(cfg, mb, storage.NewMemoryDetectorStateStore(),
+		storage.NewMemoryOddsStore(cfg.Redis.OddsTTL.Duration), opportunities)
+
+	wantID := opportunityID(&models.ArbitrageOpportunity{
+		EventID: "lakers-vs-celtics", MarketType: "moneyline", BookmakerHome: "booka", BookmakerAway: "bookb",
+	})
+
+	steps := []struct {
+		name      string
+		book      string
+		home      float64
+		away      float64
+		wantEvent string // of the open opportunity, "" for none
+	}{
+		{name: "first quote", book: "booka", home: 2.2, away: 1.8},
+		{name: "arbitrage opens", book: "bookb", home: 1.8, away: 2.2, wantEvent: models.OpportunityOpened},
+		{name: "same prices requoted", book: "booka", home: 2.2, away: 1.8, wantEvent: models.OpportunityOpened},
+		{name: "profit moves", book: "booka", home: 2.15, away: 1.8, wantEvent: models.OpportunityUpdated},
+		{name: "other leg requoted", book: "bookb", home: 1.85, away: 2.2, wantEvent: models.OpportunityUpdated},
+		{name: "prices move", book: "booka", home: 1.8, away: 1.8},
+		{name: "arbitrage opens again", book: "booka", home: 2.2, away: 1.8, wantEvent: models.OpportunityOpened},
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	for i, step := range steps {
+		odds := &models.OddsUpdate{
+			EventID:    "lakers-vs-celtics",
+			Sport:      "NBA",
+			HomeTeam:   "Lakers",
+			AwayTeam:   "Celtics",
+			Bookmaker:  step.book,
+			HomeOdds:   step.home,
+			AwayOdds:   step.away,
+			Timestamp:  start.Add(time.Duration(i) * time.Millisecond),
+			MarketType: "moneyline",
+		}
+		if err := d.processOdds(ctx, 0, odds); err != nil {
+			t.Fatalf("%s: processOdds(): %v", step.name, err)
+		}
+
+		open, _, err := opportunities.ActiveOpportunities(ctx, storage.Page{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step.wantEvent == "" {
+			if len(open) != 0 {
+				t.Errorf("%s: %d opportunities open, want none", step.name, len(open))
+			}
+			continue
+		}
+		if len(open) != 1 {
+			t.Fatalf("%s: %d opportunities open, want 1", step.name, len(open))
+		}
+		if open[0].ID != wantID || open[0].Event != step.wantEvent {
+			t.Errorf("%s: open %s as %s, want %s as %s", step.name, open[0].ID, open[0].Event, wantID, step.wantEvent)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package detector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// dropRetention is how long dropped events are remembered, so late quotes
+// for them are ignored, including by a partition's next owner
+const dropRetention = 24 * time.Hour
+
+// partitionOwner moves event state between replicas through the state store as the
+// detector group rebalances
+type partitionOwner struct {
+	d *Detector
+}
+
+// Assigned loads the snapshots the partitions' previous owner saved, then
+// the quotes the fetchers cached for their events
+func (o partitionOwner) Assigned(ctx context.Context, partitions []int, partitionOf bus.Partitioner) error {
+	for _, partition := range partitions {
+		snapshots, err := o.d.state.LoadPartition(ctx, partition)
+		if err != nil {
+			return err
+		}
+
+		for eventID, data := range snapshots {
+			var snapshot eventSnapshot
+			if err := json.Unmarshal(data, &snapshot); err != nil {
+				o.d.logger.Warn("Skipping unreadable event snapshot", "partition", partition, "event_id", eventID, "error", err)
+				continue
+			}
+			o.d.odds.restore(eventID, partition, snapshot)
+		}
+
+		o.d.logger.Info("Partition assigned", "partition", partition, "events", len(snapshots))
+	}
+
+	return o.hydrate(ctx, partitions, partitionOf)
+}
+
+// hydrate restores the latest quote of every book the fetchers cached for
+// the partitions' events. Without them the replica would find nothing
+// until each book quoted again; with them the first update it consumes is
+// paired as usual. Quotes are canonicalized as the normalizer would.
+func (o partitionOwner) hydrate(ctx context.Context, partitions []int, partitionOf bus.Partitioner) error {
+	owned := make(map[int]bool, len(partitions))
+	for _, partition := range partitions {
+		owned[partition] = true
+	}
+
+	start := time.Now()
+	scanned, restored := 0, 0
+
+	err := o.d.quotes.ScanOdds(ctx, func(batch []models.OddsUpdate) error {
+		for _, quote := range batch {
+			odds := quote // kept by the cache
+			scanned++
+
+			if err := o.d.rules.Apply(&odds); err != nil {
+				continue
+			}
+			if err := odds.Validate(); err != nil {
+				continue
+			}
+
+			partition := partitionOf(odds.EventID)
+			if !owned[partition] {
+				continue
+			}
+			o.d.odds.restore(odds.EventID, partition, eventSnapshot{Quotes: []*models.OddsUpdate{&odds}})
+			restored++
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore cached odds: %w", err)
+	}
+
+	o.d.logger.Info("Restored cached quotes", "partitions", partitions, "scanned", scanned,
+		"restored", restored, "duration", time.Since(start))
+	return nil
+}
+
+// Revoked saves the partitions' events for their next owner and forgets
+// them. Stale quotes are pruned first so they aren't carried over.
+func (o partitionOwner) Revoked(ctx context.Context, partitions []int) {
+	// ctx survives shutdown, so bound the saves by the detector's deadline
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(o.d.ctx, cancel)()
+	o.d.odds.prune(time.Now(), o.d.cfg.Detector.CacheRetention.Duration, dropRetention)
+
+	for _, partition := range partitions {
+		snapshots := o.d.odds.take(partition)
+
+		fields := make(map[string][]byte, len(snapshots))
+		for eventID, snapshot := range snapshots {
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				o.d.logger.Error("Error encoding event snapshot", "partition", partition, "event_id", eventID, "error", err)
+				continue
+			}
+			fields[eventID] = data
+		}
+
+		if err := o.d.state.SavePartition(ctx, partition, fields, dropRetention); err != nil {
+			o.d.logger.Error("Error saving partition", "partition", partition, "events", len(snapshots), "error", err)
+			continue
+		}
+
+		o.d.logger.Info("Partition revoked", "partition", partition, "events", len(snapshots))
+	}
+}
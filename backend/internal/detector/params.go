@@ -0,0 +1,445 @@
+package detector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/arbitrage"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Params are the detection settings that can change while the detector runs.
+// They are read from a YAML file or a Redis hash and applied on top of the
+// startup config, so removing a setting restores its configured value.
+type Params struct {
+	MinProfit       float64                    `yaml:"min_profit" json:"min_profit"`
+	PreMatchMaxAge  config.Duration            `yaml:"prematch_max_age" json:"prematch_max_age"`
+	LiveMaxAge      config.Duration            `yaml:"live_max_age" json:"live_max_age"`
+	PreMatchMarkets map[string]config.Duration `yaml:"prematch_markets" json:"prematch_markets"`
+	LiveMarkets     map[string]config.Duration `yaml:"live_markets" json:"live_markets"`
+	PreMatchExpiry  config.Duration            `yaml:"prematch_expiry" json:"prematch_expiry"`
+	LiveExpiry      config.Duration            `yaml:"live_expiry" json:"live_expiry"`
+	Sports          map[string]SportFilter     `yaml:"sports" json:"sports"`
+	Bookmakers      map[string]bool            `yaml:"bookmakers" json:"bookmakers"` // false disables a book
+}
+
+// SportFilter narrows detection for one sport
+type SportFilter struct {
+	Disabled  bool    `yaml:"disabled" json:"disabled"`
+	MinProfit float64 `yaml:"min_profit" json:"min_profit"` // overrides the global minimum when higher
+}
+
+func defaultParams(cfg config.DetectorConfig) Params {
+	p := Params{
+		MinProfit:       cfg.MinProfit,
+		PreMatchMaxAge:  cfg.PreMatchMaxAge,
+		LiveMaxAge:      cfg.LiveMaxAge,
+		PreMatchMarkets: make(map[string]config.Duration),
+		LiveMarkets:     make(map[string]config.Duration),
+		PreMatchExpiry:  cfg.PreMatchExpiry,
+		LiveExpiry:      cfg.LiveExpiry,
+		Sports:          make(map[string]SportFilter),
+		Bookmakers:      make(map[string]bool),
+	}
+	for market, d := range cfg.PreMatchMarkets {
+		p.PreMatchMarkets[market] = d
+	}
+	for market, d := range cfg.LiveMarkets {
+		p.LiveMarkets[market] = d
+	}
+	return p
+}
+
+func (p Params) validate() error {
+	if p.MinProfit < 0 {
+		return fmt.Errorf("min_profit must not be negative")
+	}
+	durations := p.windows()
+	durations["prematch_expiry"] = p.PreMatchExpiry.Duration
+	durations["live_expiry"] = p.LiveExpiry.Duration
+	for key, d := range durations {
+		if d <= 0 {
+			return fmt.Errorf("%s must be a positive duration", key)
+		}
+	}
+	for sport, filter := range p.Sports {
+		if filter.MinProfit < 0 {
+			return fmt.Errorf("sports.%s.min_profit must not be negative", sport)
+		}
+	}
+	return nil
+}
+
+// freshness converts the params into the calculator's freshness policy,
+// with no pair's window shorter than either book's fetch interval
+func (p Params) freshness(fetcher config.FetcherConfig) arbitrage.FreshnessPolicy {
+	policy := arbitrage.FreshnessPolicy{
+		PreMatchMaxAge:  make(map[string]time.Duration),
+		LiveMaxAge:      make(map[string]time.Duration),
+		DefaultPreMatch: p.PreMatchMaxAge.Duration,
+		DefaultLive:     p.LiveMaxAge.Duration,
+		PreMatchExpiry:  p.PreMatchExpiry.Duration,
+		LiveExpiry:      p.LiveExpiry.Duration,
+		MinAges:         make(map[string]time.Duration),
+		DefaultMinAge:   fetcher.DefaultInterval.Duration,
+	}
+	for book, d := range fetcher.Intervals {
+		policy.MinAges[book] = d.Duration
+	}
+	for market, d := range p.PreMatchMarkets {
+		policy.PreMatchMaxAge[market] = d.Duration
+	}
+	for market, d := range p.LiveMarkets {
+		policy.LiveMaxAge[market] = d.Duration
+	}
+	return policy
+}
+
+// flatten lists every setting under the field names of the Redis hash:
+// min_profit, prematch_market.<type>, sport.<sport>.disabled,
+// bookmaker.<book> and so on
+func (p Params) flatten() map[string]string {
+	flat := map[string]string{
+		"min_profit":       strconv.FormatFloat(p.MinProfit, 'f', -1, 64),
+		"prematch_max_age": p.PreMatchMaxAge.String(),
+		"live_max_age":     p.LiveMaxAge.String(),
+		"prematch_expiry":  p.PreMatchExpiry.String(),
+		"live_expiry":      p.LiveExpiry.String(),
+	}
+	for market, d := range p.PreMatchMarkets {
+		flat["prematch_market."+market] = d.String()
+	}
+	for market, d := range p.LiveMarkets {
+		flat["live_market."+market] = d.String()
+	}
+	for sport, filter := range p.Sports {
+		flat["sport."+sport+".disabled"] = strconv.FormatBool(filter.Disabled)
+		flat["sport."+sport+".min_profit"] = strconv.FormatFloat(filter.MinProfit, 'f', -1, 64)
+	}
+	for book, enabled := range p.Bookmakers {
+		flat["bookmaker."+book] = strconv.FormatBool(enabled)
+	}
+	return flat
+}
+
+// apply sets one flattened field
+func (p *Params) apply(field, value string) error {
+	var err error
+	parseDuration := func() config.Duration {
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		return config.Duration{Duration: d}
+	}
+
+	switch {
+	case field == "min_profit":
+		p.MinProfit, err = strconv.ParseFloat(value, 64)
+	case field == "prematch_max_age":
+		p.PreMatchMaxAge = parseDuration()
+	case field == "live_max_age":
+		p.LiveMaxAge = parseDuration()
+	case field == "prematch_expiry":
+		p.PreMatchExpiry = parseDuration()
+	case field == "live_expiry":
+		p.LiveExpiry = parseDuration()
+	case strings.HasPrefix(field, "prematch_market."):
+		p.PreMatchMarkets[strings.TrimPrefix(field, "prematch_market.")] = parseDuration()
+	case strings.HasPrefix(field, "live_market."):
+		p.LiveMarkets[strings.TrimPrefix(field, "live_market.")] = parseDuration()
+	case strings.HasPrefix(field, "bookmaker."):
+		p.Bookmakers[strings.TrimPrefix(field, "bookmaker.")], err = strconv.ParseBool(value)
+	case strings.HasPrefix(field, "sport."):
+		rest := strings.TrimPrefix(field, "sport.")
+		dot := strings.LastIndex(rest, ".")
+		if dot < 0 {
+			return fmt.Errorf("unknown field %s", field)
+		}
+		sport, setting := rest[:dot], rest[dot+1:]
+		filter := p.Sports[sport]
+		switch setting {
+		case "disabled":
+			filter.Disabled, err = strconv.ParseBool(value)
+		case "min_profit":
+			filter.MinProfit, err = strconv.ParseFloat(value, 64)
+		default:
+			return fmt.Errorf("unknown field %s", field)
+		}
+		p.Sports[sport] = filter
+	default:
+		return fmt.Errorf("unknown field %s", field)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	return nil
+}
+
+// diffParams describes every setting that differs between two param sets
+func diffParams(before, after Params) []string {
+	old, cur := before.flatten(), after.flatten()
+
+	var changes []string
+	for key, value := range cur {
+		if prev, ok := old[key]; !ok {
+			changes = append(changes, fmt.Sprintf("%s: (unset) → %s", key, value))
+		} else if prev != value {
+			changes = append(changes, fmt.Sprintf("%s: %s → %s", key, prev, value))
+		}
+	}
+	for key, prev := range old {
+		if _, ok := cur[key]; !ok {
+			changes = append(changes, fmt.Sprintf("%s: %s → (unset)", key, prev))
+		}
+	}
+
+	sort.Strings(changes)
+	return changes
+}
+
+// activeParams is what the hot path reads, swapped atomically on reload
+type activeParams struct {
+	Params     Params    `json:"params"`
+	Source     string    `json:"source"`
+	LoadedAt   time.Time `json:"loaded_at"`
+	calculator *arbitrage.Calculator
+	freshness  arbitrage.FreshnessPolicy
+}
+
+// windows lists the max ages under their flattened names
+func (p Params) windows() map[string]time.Duration {
+	windows := map[string]time.Duration{
+		"prematch_max_age": p.PreMatchMaxAge.Duration,
+		"live_max_age":     p.LiveMaxAge.Duration,
+	}
+	for market, d := range p.PreMatchMarkets {
+		windows["prematch_market."+market] = d.Duration
+	}
+	for market, d := range p.LiveMarkets {
+		windows["live_market."+market] = d.Duration
+	}
+	return windows
+}
+
+// shortWindows lists the max ages shorter than some book's fetch interval,
+// which the policy raises for pairs quoted by that book
+func (p Params) shortWindows(fetcher config.FetcherConfig) []string {
+	slowest := fetcher.SlowestInterval()
+	var short []string
+	for key, d := range p.windows() {
+		if d < slowest {
+			short = append(short, key)
+		}
+	}
+	sort.Strings(short)
+	return short
+}
+
+// minProfitFor returns the profit threshold for a sport
+func (a *activeParams) minProfitFor(sport string) float64 {
+	if filter, ok := a.Params.Sports[sport]; ok && filter.MinProfit > a.Params.MinProfit {
+		return filter.MinProfit
+	}
+	return a.Params.MinProfit
+}
+
+// sportEnabled reports whether a sport is being scanned
+func (a *activeParams) sportEnabled(sport string) bool {
+	return !a.Params.Sports[sport].Disabled
+}
+
+// bookEnabled reports whether a bookmaker's quotes are used
+func (a *activeParams) bookEnabled(book string) bool {
+	enabled, ok := a.Params.Bookmakers[book]
+	return !ok || enabled
+}
+
+// ParamChange is one audit log entry
+type ParamChange struct {
+	At      time.Time `json:"at"`
+	Source  string    `json:"source"`
+	Changes []string  `json:"changes,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+const maxAuditEntries = 100
+
+type auditLog struct {
+	mu      sync.RWMutex
+	entries []ParamChange
+}
+
+func (a *auditLog) record(change ParamChange) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries = append(a.entries, change)
+	if len(a.entries) > maxAuditEntries {
+		a.entries = a.entries[len(a.entries)-maxAuditEntries:]
+	}
+}
+
+func (a *auditLog) list() []ParamChange {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]ParamChange(nil), a.entries...)
+}
+
+// setParams validates and atomically swaps in a new param set
+func (d *Detector) setParams(params Params, source string) error {
+	if err := params.validate(); err != nil {
+		d.audit.record(ParamChange{At: time.Now(), Source: source, Error: err.Error()})
+		return err
+	}
+
+	next := &activeParams{
+		Params:     params,
+		Source:     source,
+		LoadedAt:   time.Now(),
+		calculator: arbitrage.NewCalculator(params.MinProfit, d.cfg.Detector.TotalStake),
+		freshness:  params.freshness(d.cfg.Fetcher),
+	}
+
+	var changes []string
+	if prev := d.params.Load(); prev != nil {
+		changes = diffParams(prev.Params, params)
+		if len(changes) == 0 {
+			return nil
+		}
+	}
+
+	d.params.Store(next)
+	d.audit.record(ParamChange{At: next.LoadedAt, Source: source, Changes: changes})
+	for _, change := range changes {
+		d.logger.Info("Param changed", "source", source, "change", change)
+	}
+	if short := params.shortWindows(d.cfg.Fetcher); len(short) > 0 {
+		d.logger.Info("Raising max ages for pairs with a book polled less often",
+			"source", source, "settings", short,
+			"default_interval", d.cfg.Fetcher.DefaultInterval.String(), "intervals", d.cfg.Fetcher.Intervals)
+	}
+
+	return nil
+}
+
+// watchParams polls the configured params source and applies changes
+func (d *Detector) watchParams(ctx context.Context) {
+	defer d.wg.Done()
+
+	cfg := d.cfg.Detector
+	ticker := time.NewTicker(cfg.ParamsPollInterval.Duration)
+	defer ticker.Stop()
+
+	var lastFile []byte
+	var lastHash map[string]string
+	var lastErr string
+
+	for {
+		var params Params
+		var source string
+		var changed bool
+		var err error
+
+		switch {
+		case cfg.ParamsFile != "":
+			source = "file:" + cfg.ParamsFile
+			params, lastFile, changed, err = d.readParamsFile(lastFile)
+		case cfg.ParamsRedisKey != "":
+			source = "redis:" + cfg.ParamsRedisKey
+			params, lastHash, changed, err = d.readParamsHash(ctx, lastHash)
+		}
+
+		if err != nil {
+			// Only report a failure once until it changes
+			if err.Error() != lastErr {
+				d.logger.Error("Error reading params", "source", source, "error", err)
+				d.audit.record(ParamChange{At: time.Now(), Source: source, Error: err.Error()})
+			}
+			lastErr = err.Error()
+		} else if changed {
+			lastErr = ""
+			if err := d.setParams(params, source); err != nil {
+				d.logger.Warn("Rejected params", "source", source, "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Detector) readParamsFile(last []byte) (Params, []byte, bool, error) {
+	data, err := os.ReadFile(d.cfg.Detector.ParamsFile)
+	if err != nil {
+		return Params{}, last, false, err
+	}
+	if last != nil && bytes.Equal(data, last) {
+		return Params{}, last, false, nil
+	}
+
+	params := defaultParams(d.cfg.Detector)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&params); err != nil && len(bytes.TrimSpace(data)) > 0 {
+		return Params{}, data, false, err
+	}
+
+	return params, data, true, nil
+}
+
+func (d *Detector) readParamsHash(ctx context.Context, last map[string]string) (Params, map[string]string, bool, error) {
+	hash, err := d.state.Params(ctx, d.cfg.Detector.ParamsRedisKey)
+	if err != nil {
+		return Params{}, last, false, err
+	}
+	if last != nil && equalHash(hash, last) {
+		return Params{}, last, false, nil
+	}
+
+	params := defaultParams(d.cfg.Detector)
+	for field, value := range hash {
+		if err := params.apply(field, value); err != nil {
+			return Params{}, hash, false, err
+		}
+	}
+
+	return params, hash, true, nil
+}
+
+func equalHash(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterRoutes exposes the live params and their audit log on an admin mux
+func (d *Detector) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/params", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.params.Load())
+	})
+
+	mux.HandleFunc("/params/audit", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.audit.list())
+	})
+}
@@ -0,0 +1,122 @@
+package detector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+)
+
+// TestLiveFreshnessWindow pairs a live spread quote with one 4s older. The
+// 3s live spread window holds for books polled faster than it and is only
+// raised for a pair with a book polled less often.
+func TestLiveFreshnessWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals map[string]config.Duration
+		wantOpen  bool
+	}{
+		{
+			name:      "both books polled faster than the window",
+			intervals: map[string]config.Duration{"booka": {Duration: time.Second}, "bookb": {Duration: 2 * time.Second}},
+		},
+		{
+			name:      "one book polled less often",
+			intervals: map[string]config.Duration{"booka": {Duration: time.Second}},
+			wantOpen:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Detector.LiveMarkets["spread"] = config.Duration{Duration: 3 * time.Second}
+			cfg.Fetcher.DefaultInterval = config.Duration{Duration: 10 * time.Second}
+			cfg.Fetcher.Intervals = tt.intervals
+
+			mb := bus.NewMemory(cfg.HTTP.BroadcastBuffer)
+			t.Cleanup(func() { mb.Close() })
+			opportunities := storage.NewMemoryOpportunityStore()
+			d := NewDetector(cfg, mb, storage.NewMemoryDetectorStateStore(),
+				storage.NewMemoryOddsStore(cfg.Redis.OddsTTL.Duration), opportunities)
+
+			ctx := context.Background()
+			if err := d.markLive("lakers-vs-celtics", 0); err != nil {
+				t.Fatalf("markLive(): %v", err)
+			}
+
+			now := time.Now()
+			for _, odds := range []*models.OddsUpdate{
+				{Bookmaker: "booka", HomeOdds: 2.2, AwayOdds: 1.8, Timestamp: now.Add(-4 * time.Second)},
+				{Bookmaker: "bookb", HomeOdds: 1.8, AwayOdds: 2.2, Timestamp: now},
+			} {
+				odds.EventID, odds.Sport, odds.HomeTeam, odds.AwayTeam = "lakers-vs-celtics", "NBA", "Lakers", "Celtics"
+				odds.MarketType = "spread"
+				if err := d.processOdds(ctx, 0, odds); err != nil {
+					t.Fatalf("processOdds(): %v", err)
+				}
+			}
+
+			open, _, err := opportunities.ActiveOpportunities(ctx, storage.Page{Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(open) > 0; got != tt.wantOpen {
+				t.Errorf("%d opportunities open, want open = %v", len(open), tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestParamsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		adjust  func(p *Params)
+		wantErr string
+	}{
+		{name: "defaults", adjust: func(p *Params) {}},
+		{name: "negative min_profit", adjust: func(p *Params) { p.MinProfit = -1 }, wantErr: "min_profit"},
+		{name: "zero prematch_max_age", adjust: func(p *Params) { p.PreMatchMaxAge.Duration = 0 }, wantErr: "prematch_max_age"},
+		{name: "negative live_max_age", adjust: func(p *Params) { p.LiveMaxAge.Duration = -time.Second }, wantErr: "live_max_age"},
+		{
+			name:    "zero live market window",
+			adjust:  func(p *Params) { p.LiveMarkets["spread"] = config.Duration{} },
+			wantErr: "live_market.spread",
+		},
+		{
+			name:    "zero pre-match market window",
+			adjust:  func(p *Params) { p.PreMatchMarkets["total"] = config.Duration{} },
+			wantErr: "prematch_market.total",
+		},
+		{name: "zero prematch_expiry", adjust: func(p *Params) { p.PreMatchExpiry.Duration = 0 }, wantErr: "prematch_expiry"},
+		{name: "zero live_expiry", adjust: func(p *Params) { p.LiveExpiry.Duration = 0 }, wantErr: "live_expiry"},
+		{
+			name:    "negative sport min_profit",
+			adjust:  func(p *Params) { p.Sports["NBA"] = SportFilter{MinProfit: -1} },
+			wantErr: "sports.NBA.min_profit",
+		},
+		{name: "disabled sport", adjust: func(p *Params) { p.Sports["NBA"] = SportFilter{Disabled: true} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := defaultParams(config.Default().Detector)
+			tt.adjust(&p)
+			err := p.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate(): %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Package e2e runs the whole pipeline in one process over the in-memory
+// bus and stores, as cmd/dev does
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/matthewhu/sportarbitrage/internal/api"
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/detector"
+	"github.com/matthewhu/sportarbitrage/internal/events"
+	"github.com/matthewhu/sportarbitrage/internal/fetcher"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/normalizer"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+)
+
+// books are the simulated sportsbooks the test fetches from
+var books = []string{"draftkings", "fanduel", "betmgm", "caesars", "pointsbet"}
+
+// freePort returns a port nothing is listening on
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+// waitReady polls the API's /ready until it reports ready
+func waitReady(t *testing.T, base string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(base + "/ready")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("API never became ready")
+}
+
+// TestPipeline fetches simulated odds, normalizes them and detects
+// arbitrage, and checks an opportunity reaches a WebSocket client through
+// the bus and is listed by the REST API
+func TestPipeline(t *testing.T) {
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	t.Cleanup(func() { slog.SetDefault(logger) })
+
+	cfg := config.Default()
+	cfg.HTTP.Port = freePort(t)
+	base := "http://127.0.0.1:" + cfg.HTTP.Port
+
+	b := bus.NewMemory(cfg.HTTP.BroadcastBuffer)
+	quotes := storage.NewMemoryOddsStore(cfg.Redis.OddsTTL.Duration)
+	opportunities := storage.NewMemoryOpportunityStore()
+
+	n := normalizer.NewNormalizer(cfg, b)
+	d := detector.NewDetector(cfg, b, storage.NewMemoryDetectorStateStore(), quotes, opportunities)
+	server := api.NewServer(cfg, b, opportunities, quotes, storage.NewMemoryEventStore())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	run := func(fn func(ctx context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(ctx)
+		}()
+	}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+		shutdown, done := context.WithTimeout(context.Background(), 5*time.Second)
+		defer done()
+		server.Close(shutdown)
+		b.Close()
+	})
+
+	// Subscribers go first so nothing the fetchers publish is missed
+	run(d.Run)
+	run(n.Run)
+	run(func(ctx context.Context) { server.Run(ctx) })
+	waitReady(t, base)
+
+	// Connected before anything is fetched, so whatever arrives came over
+	// the bus rather than in the snapshot
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:"+cfg.HTTP.Port+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dialing the WebSocket: %v", err)
+	}
+	defer conn.Close()
+
+	for _, book := range books {
+		run(fetcher.NewFetcher(cfg, book, b, quotes).Run)
+	}
+
+	arb := readArbitrage(t, conn)
+
+	scheduled := make(map[string]bool)
+	for _, game := range events.SimulatedSchedule(time.Now()) {
+		scheduled[game.ID] = true
+	}
+	if !scheduled[arb.EventID] {
+		t.Errorf("opportunity for %s, which isn't on the simulated schedule", arb.EventID)
+	}
+	fetched := make(map[string]bool, len(books))
+	for _, book := range books {
+		fetched[book] = true
+	}
+	if !fetched[arb.BookmakerHome] || !fetched[arb.BookmakerAway] {
+		t.Errorf("opportunity between %s and %s, which weren't fetched from", arb.BookmakerHome, arb.BookmakerAway)
+	}
+	if arb.ProfitPercent <= 0 {
+		t.Errorf("opportunity profit is %v%%", arb.ProfitPercent)
+	}
+
+	listed, err := listArbitrage(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range listed {
+		if l.ID == arb.ID {
+			return
+		}
+	}
+	t.Errorf("pushed opportunity %s isn't listed by /api/arbitrage", arb.ID)
+}
+
+// readArbitrage returns the first opportunity pushed to conn
+func readArbitrage(t *testing.T, conn *websocket.Conn) models.ArbitrageOpportunity {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(15 * time.Second))
+	for {
+		var msg struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("no opportunity pushed: %v", err)
+		}
+		if msg.Type != "arbitrage" {
+			continue
+		}
+
+		var arb models.ArbitrageOpportunity
+		if err := json.Unmarshal(msg.Data, &arb); err != nil {
+			t.Fatalf("decoding the pushed opportunity: %v", err)
+		}
+		if arb.Event != models.OpportunityClosed {
+			return arb
+		}
+	}
+}
+
+func listArbitrage(base string) ([]models.ArbitrageOpportunity, error) {
+	resp, err := http.Get(base + "/api/arbitrage")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("/api/arbitrage returned %s", resp.Status)
+	}
+
+	var listed []models.ArbitrageOpportunity
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		return nil, fmt.Errorf("decoding /api/arbitrage: %w", err)
+	}
+	return listed, nil
+}
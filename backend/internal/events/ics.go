@@ -0,0 +1,183 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// ICSFileProvider reads a schedule from an iCalendar file.
+// SUMMARY is "Away @ Home" or "Home vs Away", CATEGORIES is "sport[,league]".
+// All-day events (DTSTART;VALUE=DATE) run from midnight to DTEND, or for
+// the one day without it. An event's ID is its UID, or the meeting of its
+// teams at its start time without one, so repeat fixtures stay apart.
+// Events that can't be read are logged and skipped.
+type ICSFileProvider struct {
+	Path string
+}
+
+// Name identifies the provider in logs
+func (p *ICSFileProvider) Name() string {
+	return "ics:" + p.Path
+}
+
+// Schedule reads and parses the calendar file
+func (p *ICSFileProvider) Schedule(ctx context.Context) ([]models.Event, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule: %w", err)
+	}
+	return parseICS(data), nil
+}
+
+func parseICS(data []byte) []models.Event {
+	var schedule []models.Event
+	var current map[string]icsProperty
+
+	for _, line := range unfoldICS(data) {
+		switch {
+		case line == "BEGIN:VEVENT":
+			current = make(map[string]icsProperty)
+		case line == "END:VEVENT":
+			if current == nil {
+				continue
+			}
+			ev, ok, err := icsEvent(current)
+			if err != nil {
+				slog.Warn("Skipping calendar event", "component", "events",
+					"uid", current["UID"].value, "error", err)
+			} else if ok {
+				schedule = append(schedule, ev)
+			}
+			current = nil
+		case current != nil:
+			prop := parseICSProperty(line)
+			current[prop.name] = prop
+		}
+	}
+
+	return schedule
+}
+
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// unfoldICS joins continuation lines, which start with a space or tab
+func unfoldICS(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func parseICSProperty(line string) icsProperty {
+	prop := icsProperty{params: make(map[string]string)}
+
+	head, value, _ := strings.Cut(line, ":")
+	prop.value = value
+
+	parts := strings.Split(head, ";")
+	prop.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		if k, v, ok := strings.Cut(param, "="); ok {
+			prop.params[strings.ToUpper(k)] = v
+		}
+	}
+
+	return prop
+}
+
+func icsEvent(props map[string]icsProperty) (models.Event, bool, error) {
+	var ev models.Event
+
+	if strings.EqualFold(props["STATUS"].value, "CANCELLED") {
+		return ev, false, nil
+	}
+
+	summary := props["SUMMARY"].value
+	if away, home, ok := strings.Cut(summary, " @ "); ok {
+		ev.HomeTeam, ev.AwayTeam = strings.TrimSpace(home), strings.TrimSpace(away)
+	} else if home, away, ok := strings.Cut(summary, " vs "); ok {
+		ev.HomeTeam, ev.AwayTeam = strings.TrimSpace(home), strings.TrimSpace(away)
+	} else {
+		return ev, false, fmt.Errorf("unrecognised event summary %q", summary)
+	}
+
+	if categories := props["CATEGORIES"].value; categories != "" {
+		sport, league, _ := strings.Cut(categories, ",")
+		ev.Sport = strings.TrimSpace(sport)
+		ev.League = strings.TrimSpace(league)
+		if ev.League == "" {
+			ev.League = ev.Sport
+		}
+	}
+
+	start, err := parseICSTime(props["DTSTART"])
+	if err != nil {
+		return ev, false, fmt.Errorf("event %q: invalid DTSTART: %w", summary, err)
+	}
+	ev.StartTime = start
+
+	if end, ok := props["DTEND"]; ok {
+		if ev.EndTime, err = parseICSTime(end); err != nil {
+			return ev, false, fmt.Errorf("event %q: invalid DTEND: %w", summary, err)
+		}
+	} else if isICSDate(props["DTSTART"]) {
+		ev.EndTime = start.AddDate(0, 0, 1)
+	}
+
+	ev.ID = strings.TrimSpace(props["UID"].value)
+	if ev.ID == "" {
+		ev.ID = MeetingID(ev.HomeTeam, ev.AwayTeam, ev.StartTime)
+	}
+	return ev, true, nil
+}
+
+func isICSDate(prop icsProperty) bool {
+	return strings.EqualFold(prop.params["VALUE"], "DATE")
+}
+
+func parseICSTime(prop icsProperty) (time.Time, error) {
+	if prop.value == "" {
+		return time.Time{}, fmt.Errorf("missing")
+	}
+	if strings.HasSuffix(prop.value, "Z") {
+		return time.Parse("20060102T150405Z", prop.value)
+	}
+
+	loc := time.UTC
+	if tzid := prop.params["TZID"]; tzid != "" {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID %s: %w", tzid, err)
+		}
+		loc = l
+	}
+
+	layout := "20060102T150405"
+	if isICSDate(prop) {
+		layout = "20060102"
+	}
+	t, err := time.ParseInLocation(layout, prop.value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q: %w", prop.value, err)
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,246 @@
+package events
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// calendar wraps VEVENT lines in a VCALENDAR with CRLF line endings
+func calendar(lines ...string) []byte {
+	all := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...)
+	all = append(all, "END:VCALENDAR")
+	return []byte(strings.Join(all, "\r\n") + "\r\n")
+}
+
+func TestParseICS(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []models.Event
+	}{
+		{
+			name: "away at home",
+			data: calendar(
+				"BEGIN:VEVENT",
+				"SUMMARY:Boston Celtics @ Los Angeles Lakers",
+				"CATEGORIES:basketball,NBA",
+				"DTSTART:20260301T190000Z",
+				"DTEND:20260301T213000Z",
+				"END:VEVENT",
+			),
+			want: []models.Event{{
+				ID:        "los-angeles-lakers-vs-boston-celtics-20260301-1900",
+				Sport:     "basketball",
+				League:    "NBA",
+				HomeTeam:  "Los Angeles Lakers",
+				AwayTeam:  "Boston Celtics",
+				StartTime: time.Date(2026, 3, 1, 19, 0, 0, 0, time.UTC),
+				EndTime:   time.Date(2026, 3, 1, 21, 30, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "home vs away, league defaults to sport",
+			data: calendar(
+				"BEGIN:VEVENT",
+				"SUMMARY:Arsenal vs Chelsea",
+				"CATEGORIES:soccer",
+				"DTSTART:20260301T150000Z",
+				"END:VEVENT",
+			),
+			want: []models.Event{{
+				ID:        "arsenal-vs-chelsea-20260301-1500",
+				Sport:     "soccer",
+				League:    "soccer",
+				HomeTeam:  "Arsenal",
+				AwayTeam:  "Chelsea",
+				StartTime: time.Date(2026, 3, 1, 15, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "folded lines",
+			data: calendar(
+				"BEGIN:VEVENT",
+				"SUMMARY:Arsenal vs Manch",
+				" ester United",
+				"DTSTART:20260301T150000Z",
+				"END:VEVENT",
+			),
+			want: []models.Event{{
+				ID:        "arsenal-vs-manchester-united-20260301-1500",
+				HomeTeam:  "Arsenal",
+				AwayTeam:  "Manchester United",
+				StartTime: time.Date(2026, 3, 1, 15, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "all-day event runs for the day",
+			data: calendar(
+				"BEGIN:VEVENT",
+				"SUMMARY:Arsenal vs Chelsea",
+				"DTSTART;VALUE=DATE:20260301",
+				"END:VEVENT",
+			),
+			want: []models.Event{{
+				ID:        "arsenal-vs-chelsea-20260301-0000",
+				HomeTeam:  "Arsenal",
+				AwayTeam:  "Chelsea",
+				StartTime: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+				EndTime:   time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "UID names the event",
+			data: calendar(
+				"BEGIN:VEVENT",
+				"UID:fixture-1234@league.example",
+				"SUMMARY:Arsenal vs Chelsea",
+				"DTSTART:20260301T150000Z",
+				"END:VEVENT",
+			),
+			want: []models.Event{{
+				ID:        "fixture-1234@league.example",
+				HomeTeam:  "Arsenal",
+				AwayTeam:  "Chelsea",
+				StartTime: time.Date(2026, 3, 1, 15, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "repeat meetings of the same teams stay apart",
+			data: calendar(
+				"BEGIN:VEVENT",
+				"SUMMARY:Arsenal vs Chelsea",
+				"DTSTART:20260301T150000Z",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Arsenal vs Chelsea",
+				"DTSTART:20260412T163000Z",
+				"END:VEVENT",
+			),
+			want: []models.Event{
+				{
+					ID:        "arsenal-vs-chelsea-20260301-1500",
+					HomeTeam:  "Arsenal",
+					AwayTeam:  "Chelsea",
+					StartTime: time.Date(2026, 3, 1, 15, 0, 0, 0, time.UTC),
+				},
+				{
+					ID:        "arsenal-vs-chelsea-20260412-1630",
+					HomeTeam:  "Arsenal",
+					AwayTeam:  "Chelsea",
+					StartTime: time.Date(2026, 4, 12, 16, 30, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			name: "cancelled events are dropped",
+			data: calendar(
+				"BEGIN:VEVENT",
+				"SUMMARY:Arsenal vs Chelsea",
+				"STATUS:CANCELLED",
+				"DTSTART:20260301T150000Z",
+				"END:VEVENT",
+			),
+		},
+		{
+			name: "unreadable events are skipped",
+			data: calendar(
+				"BEGIN:VEVENT",
+				"SUMMARY:Team meeting",
+				"DTSTART:20260301T150000Z",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Arsenal vs Chelsea",
+				"DTSTART:not a time",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Liverpool vs Everton",
+				"DTSTART:20260301T173000Z",
+				"END:VEVENT",
+			),
+			want: []models.Event{{
+				ID:        "liverpool-vs-everton-20260301-1730",
+				HomeTeam:  "Liverpool",
+				AwayTeam:  "Everton",
+				StartTime: time.Date(2026, 3, 1, 17, 30, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "properties outside an event are ignored",
+			data: calendar(
+				"SUMMARY:Arsenal vs Chelsea",
+				"DTSTART:20260301T150000Z",
+				"END:VEVENT",
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseICS(tt.data)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseICS() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseICSTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name: "UTC",
+			line: "DTSTART:20260301T150000Z",
+			want: time.Date(2026, 3, 1, 15, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "floating time is UTC",
+			line: "DTSTART:20260301T150000",
+			want: time.Date(2026, 3, 1, 15, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "TZID is converted to UTC",
+			line: "DTSTART;TZID=Europe/London:20260701T150000",
+			want: time.Date(2026, 7, 1, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "date",
+			line: "DTSTART;VALUE=DATE:20260301",
+			want: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "lowercase parameters",
+			line: "DTSTART;value=DATE:20260301",
+			want: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{name: "missing", line: "DTSTART:", wantErr: true},
+		{name: "unknown TZID", line: "DTSTART;TZID=Nowhere/Special:20260301T150000", wantErr: true},
+		{name: "date without VALUE=DATE", line: "DTSTART:20260301", wantErr: true},
+		{name: "garbage", line: "DTSTART:tomorrow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseICSTime(parseICSProperty(tt.line))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseICSTime(%q) = %v, want an error", tt.line, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseICSTime(%q): %v", tt.line, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseICSTime(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
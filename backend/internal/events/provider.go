@@ -0,0 +1,158 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// Provider supplies the schedule of upcoming events
+type Provider interface {
+	Name() string
+	Schedule(ctx context.Context) ([]models.Event, error)
+}
+
+// EventID builds the canonical event ID shared by fetchers and the catalogue
+func EventID(homeTeam, awayTeam string) string {
+	return fmt.Sprintf("%s-vs-%s", slug(homeTeam), slug(awayTeam))
+}
+
+// kickoffLayout suffixes a meeting ID with its start time
+const kickoffLayout = "20060102-1504"
+
+// MeetingID builds the event ID for one meeting of two teams that play
+// each other repeatedly, like the simulated games
+func MeetingID(homeTeam, awayTeam string, start time.Time) string {
+	return EventID(homeTeam, awayTeam) + "-" + start.UTC().Format(kickoffLayout)
+}
+
+func slug(s string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), " ", "-")
+}
+
+// NewFileProvider picks a JSON or ICS provider based on the file extension
+func NewFileProvider(path string) (Provider, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return &JSONFileProvider{Path: path}, nil
+	case ".ics":
+		return &ICSFileProvider{Path: path}, nil
+	default:
+		return nil, fmt.Errorf("unsupported schedule file %s (want .json or .ics)", path)
+	}
+}
+
+// JSONFileProvider reads a schedule from a JSON array of events. Events
+// without an ID are named after the meeting of their teams, or the teams
+// alone without a start time.
+type JSONFileProvider struct {
+	Path string
+}
+
+// Name identifies the provider in logs
+func (p *JSONFileProvider) Name() string {
+	return "json:" + p.Path
+}
+
+// Schedule reads and parses the schedule file
+func (p *JSONFileProvider) Schedule(ctx context.Context) ([]models.Event, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule: %w", err)
+	}
+
+	var schedule []models.Event
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule: %w", err)
+	}
+
+	for i := range schedule {
+		ev := &schedule[i]
+		switch {
+		case ev.ID != "":
+		case !ev.StartTime.IsZero():
+			ev.ID = MeetingID(ev.HomeTeam, ev.AwayTeam, ev.StartTime)
+		default:
+			ev.ID = EventID(ev.HomeTeam, ev.AwayTeam)
+		}
+	}
+
+	return schedule, nil
+}
+
+// SimulatedProvider schedules the games the simulated fetchers quote
+type SimulatedProvider struct{}
+
+// NewSimulatedProvider creates a provider for the simulated schedule
+func NewSimulatedProvider() *SimulatedProvider {
+	return &SimulatedProvider{}
+}
+
+// Name identifies the provider in logs
+func (p *SimulatedProvider) Name() string {
+	return "simulated"
+}
+
+// Schedule returns the simulated games around the current time
+func (p *SimulatedProvider) Schedule(ctx context.Context) ([]models.Event, error) {
+	return SimulatedSchedule(time.Now()), nil
+}
+
+var simulatedGames = []struct {
+	sport  string
+	league string
+	home   string
+	away   string
+}{
+	{"NBA", "NBA", "Lakers", "Celtics"},
+	{"NBA", "NBA", "Warriors", "Nets"},
+	{"NBA", "NBA", "Heat", "Bucks"},
+	{"NBA", "NBA", "Suns", "Nuggets"},
+	{"NFL", "NFL", "Chiefs", "Bills"},
+	{"NFL", "NFL", "Eagles", "Cowboys"},
+}
+
+const (
+	// simulatedRound is how often each simulated game is played again,
+	// long enough for the longest one to finish first
+	simulatedRound = 6 * time.Hour
+	// simulatedSpacing staggers the games' kick-offs within a round
+	simulatedSpacing = 30 * time.Minute
+)
+
+// SimulatedSchedule returns each simulated game's meeting in progress at now,
+// if any, and its next one. Rounds are aligned to UTC midnight so the
+// catalogue and every fetcher derive the same event IDs.
+func SimulatedSchedule(now time.Time) []models.Event {
+	now = now.UTC()
+
+	var schedule []models.Event
+	for i, game := range simulatedGames {
+		offset := time.Duration(i) * simulatedSpacing
+		latest := now.Add(-offset).Truncate(simulatedRound).Add(offset)
+
+		starts := []time.Time{latest.Add(simulatedRound)}
+		if now.Before(latest.Add(gameDuration(game.sport))) {
+			starts = []time.Time{latest, latest.Add(simulatedRound)}
+		}
+
+		for _, start := range starts {
+			schedule = append(schedule, models.Event{
+				ID:        MeetingID(game.home, game.away, start),
+				Sport:     game.sport,
+				League:    game.league,
+				HomeTeam:  game.home,
+				AwayTeam:  game.away,
+				StartTime: start,
+			})
+		}
+	}
+
+	return schedule
+}
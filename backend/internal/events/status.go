@@ -0,0 +1,75 @@
+package events
+
+import (
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// Typical game lengths, used to call an event final when the provider doesn't
+var gameDurations = map[string]time.Duration{
+	"NBA": 150 * time.Minute,
+	"NHL": 150 * time.Minute,
+	"NFL": 210 * time.Minute,
+	"MLB": 180 * time.Minute,
+}
+
+const defaultGameDuration = 180 * time.Minute
+
+func gameDuration(sport string) time.Duration {
+	if duration, ok := gameDurations[sport]; ok {
+		return duration
+	}
+	return defaultGameDuration
+}
+
+// EndTime returns when an event ends, or is expected to after a typical
+// game length. It is zero for events without a start time.
+func EndTime(ev *models.Event) time.Time {
+	switch {
+	case !ev.EndTime.IsZero():
+		return ev.EndTime
+	case ev.StartTime.IsZero():
+		return time.Time{}
+	}
+	return ev.StartTime.Add(gameDuration(ev.Sport))
+}
+
+var statusRank = map[string]int{
+	models.EventStatusUpcoming: 0,
+	models.EventStatusLive:     1,
+	models.EventStatusFinal:    2,
+}
+
+// CanTransition reports whether an event may move from one status to another.
+// Statuses only ever move forward: upcoming → live → final.
+func CanTransition(from, to string) bool {
+	fromRank, ok := statusRank[from]
+	if !ok {
+		return true
+	}
+	toRank, ok := statusRank[to]
+	if !ok {
+		return false
+	}
+	return toRank > fromRank
+}
+
+// ExpectedStatus derives an event's status from its schedule, ending it at
+// its end time or after a typical game length. A status reported by the
+// provider wins when it is further along.
+func ExpectedStatus(ev *models.Event, now time.Time) string {
+	status := models.EventStatusUpcoming
+
+	if !ev.StartTime.IsZero() && !now.Before(ev.StartTime) {
+		status = models.EventStatusLive
+		if !now.Before(EndTime(ev)) {
+			status = models.EventStatusFinal
+		}
+	}
+
+	if CanTransition(status, ev.Status) {
+		return ev.Status
+	}
+	return status
+}
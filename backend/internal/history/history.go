@@ -0,0 +1,128 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/matthewhu/sportarbitrage/internal/batch"
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+)
+
+// Writer records every state of every opportunity published on the
+// arbitrage topic in Postgres, in batches.
+//
+// Messages are acked once their batch is written, so opportunities still
+// buffered when the process dies, or whose write never succeeds, are
+// delivered again. Meanwhile consuming goes on, keeping pace with the
+// detector while Postgres is slow. The buffer is bounded: once it is
+// full, consuming waits for a write to succeed. Batches written while
+// shutting down can't be acked once the subscription has closed, so they
+// are delivered again after a restart; their upserts make that harmless.
+type Writer struct {
+	cfg    *config.Config
+	bus    bus.Bus
+	repo   *storage.HistoryRepository
+	batch  *batch.Writer[entry]
+	logger *slog.Logger
+}
+
+// entry is a buffered message and the opportunity it carried, nil if it
+// was dead-lettered. Dead letters are acked in turn with the rest, as an
+// ack covers every earlier offset.
+type entry struct {
+	arb *models.ArbitrageOpportunity
+	msg bus.Message
+}
+
+// NewWriter creates a writer reading opportunities from b into repo
+func NewWriter(cfg *config.Config, b bus.Bus, repo *storage.HistoryRepository) *Writer {
+	opts := batch.Options{
+		Size:          cfg.History.BatchSize,
+		FlushInterval: cfg.History.FlushInterval.Duration,
+		BufferSize:    cfg.History.BufferSize,
+		RetryInterval: cfg.History.RetryInterval.Duration,
+		DrainTimeout:  cfg.HTTP.ShutdownTimeout.Duration,
+	}
+
+	w := &Writer{
+		cfg:    cfg,
+		bus:    b,
+		repo:   repo,
+		logger: slog.With("component", "history"),
+	}
+	w.batch = batch.NewWriter("arbitrage_history", opts, w.save)
+	return w
+}
+
+// Run consumes opportunities until ctx is cancelled, then writes what is
+// buffered, giving up after the shutdown timeout
+func (w *Writer) Run(ctx context.Context) {
+	w.logger.Info("Starting arbitrage history writer", "batch_size", w.cfg.History.BatchSize,
+		"buffer_size", w.cfg.History.BufferSize)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.batch.Run(ctx)
+	}()
+
+	err := w.bus.Subscribe(ctx, w.cfg.Kafka.Topics.ArbitrageFound, w.cfg.Kafka.Groups.History, w.handle)
+	if err != nil {
+		w.logger.Error("Arbitrage subscription ended", "error", err)
+	}
+
+	// The subscription has returned, so nothing is added any more
+	w.batch.Close()
+	<-done
+}
+
+func (w *Writer) handle(ctx context.Context, msg bus.Message) {
+	e := entry{msg: msg}
+
+	var arb models.ArbitrageOpportunity
+	if err := msg.Decode(&arb); err != nil {
+		if bus.PublishDeadLetter(ctx, w.bus, "history", msg, fmt.Errorf("failed to parse arbitrage: %w", err)) != nil {
+			return
+		}
+	} else if err := arb.Validate(); err != nil {
+		if bus.PublishDeadLetter(ctx, w.bus, "history", msg, fmt.Errorf("invalid arbitrage: %w", err)) != nil {
+			return
+		}
+	} else {
+		e.arb = &arb
+	}
+
+	// Waits while the buffer is full
+	if !w.batch.Add(ctx, e) {
+		return
+	}
+
+	if err := w.bus.Defer(ctx, msg); err != nil {
+		w.logger.ErrorContext(ctx, "Error deferring ack", append(msg.LogAttrs(), "error", err)...)
+	}
+}
+
+// save writes a batch and then acks its messages. A failed ack is only
+// logged, as the rows are written.
+func (w *Writer) save(ctx context.Context, entries []entry) error {
+	opportunities := make([]models.ArbitrageOpportunity, 0, len(entries))
+	msgs := make([]bus.Message, len(entries))
+	for i, e := range entries {
+		if e.arb != nil {
+			opportunities = append(opportunities, *e.arb)
+		}
+		msgs[i] = e.msg
+	}
+
+	if err := w.repo.SaveBatch(ctx, opportunities); err != nil {
+		return err
+	}
+	if err := bus.AckLatest(ctx, w.bus, msgs); err != nil {
+		w.logger.Warn("Error acking written opportunities, they will be delivered again", "rows", len(opportunities), "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+// ConsumerOptionsFrom converts the consumer settings of the config
+func ConsumerOptionsFrom(c config.ConsumerConfig) ConsumerOptions {
+	opts := ConsumerOptions{
+		StartOffset:    kafka.FirstOffset,
+		CommitInterval: c.CommitInterval.Duration,
+		LagInterval:    c.LagInterval.Duration,
+		MaxDeliveries:  c.MaxDeliveries,
+	}
+	if c.StartOffset == "latest" {
+		opts.StartOffset = kafka.LastOffset
+	}
+	return opts
+}
+
+// Bus implements bus.Bus on top of Kafka, with one producer per topic
+// published to and one consumer per subscription
+type Bus struct {
+	brokers     []string
+	opts        ConsumerOptions
+	codecs      *Codecs
+	mu          sync.Mutex
+	producers   map[string]*Producer
+	consumers   map[string]*Consumer        // by group and topic
+	generations map[string]*ownedGeneration // current generation of owned subscriptions, by group
+}
+
+// NewBus creates a Kafka-backed bus that publishes and reads messages with
+// codecs
+func NewBus(brokers []string, opts ConsumerOptions, codecs *Codecs) *Bus {
+	return &Bus{
+		brokers:     brokers,
+		opts:        opts,
+		codecs:      codecs,
+		producers:   make(map[string]*Producer),
+		consumers:   make(map[string]*Consumer),
+		generations: make(map[string]*ownedGeneration),
+	}
+}
+
+func subscriptionKey(group, topic string) string {
+	return group + "/" + topic
+}
+
+func (b *Bus) producer(topic string) *Producer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, ok := b.producers[topic]
+	if !ok {
+		p = NewProducer(b.brokers, topic)
+		p.codec = b.codecs
+		b.producers[topic] = p
+	}
+	return p
+}
+
+// Publish sends value to topic under key
+func (b *Bus) Publish(ctx context.Context, topic, key string, value interface{}) error {
+	return b.producer(topic).Send(ctx, key, value)
+}
+
+// Subscribe consumes topic as part of group until ctx is cancelled, then
+// closes the consumer so the group rebalances straight away.
+//
+// Offsets are committed by Ack. If the handler returns without acking,
+// the consumer is reopened from the last committed offset so the message
+// and everything after it is delivered again.
+func (b *Bus) Subscribe(ctx context.Context, topic, group string, handler bus.Handler) error {
+	key := subscriptionKey(group, topic)
+	logger := slog.With("topic", topic, "group", group)
+
+	for {
+		consumer := NewConsumer(b.brokers, topic, group, b.opts)
+		b.mu.Lock()
+		b.consumers[key] = consumer
+		b.mu.Unlock()
+
+		err := b.consume(ctx, consumer, topic, group, handler)
+
+		b.mu.Lock()
+		delete(b.consumers, key)
+		b.mu.Unlock()
+		if cerr := consumer.Close(); cerr != nil {
+			logger.Error("Error closing consumer", "error", cerr)
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		logger.Warn("Rewinding consumer", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// consume feeds messages to handler until ctx is cancelled or a message
+// is left unacked
+func (b *Bus) consume(ctx context.Context, consumer *Consumer, topic, group string, handler bus.Handler) error {
+	var lagTicker <-chan time.Time
+	if b.opts.LagInterval > 0 {
+		ticker := time.NewTicker(b.opts.LagInterval)
+		defer ticker.Stop()
+		lagTicker = ticker.C
+	}
+
+	for {
+		msg, err := consumer.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			slog.Error("Error reading message", "topic", topic, "group", group, "error", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		metrics.MessagesConsumed.WithLabelValues(topic, group).Inc()
+
+		delivered := bus.Message{
+			Topic:     msg.Topic,
+			Key:       string(msg.Key),
+			Value:     msg.Value,
+			Headers:   Headers(msg),
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Timestamp: msg.Time,
+			Group:     group,
+			Decoder:   b.codecs,
+		}
+		handler(ctx, delivered)
+		if consumer.acked(msg.Partition) < msg.Offset && consumer.deferred(msg.Partition) < msg.Offset {
+			return fmt.Errorf("offset %d on partition %d was not acked", msg.Offset, msg.Partition)
+		}
+
+		select {
+		case <-lagTicker:
+			lag := consumer.Lag()
+			metrics.ConsumerLag.WithLabelValues(topic, group).Set(float64(lag))
+			slog.Info("Consumer lag", "topic", topic, "group", group, "lag", lag)
+		default:
+		}
+	}
+}
+
+// Ack commits msg's offset for its group. Owned subscriptions commit
+// acked offsets in the background.
+func (b *Bus) Ack(ctx context.Context, msg bus.Message) error {
+	b.mu.Lock()
+	consumer, ok := b.consumers[subscriptionKey(msg.Group, msg.Topic)]
+	gen, owned := b.generations[msg.Group]
+	b.mu.Unlock()
+	if !ok && owned {
+		if gen.current(ctx, msg) {
+			gen.ack(msg.Topic, msg.Partition, msg.Offset)
+		}
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("no subscription for %s in group %s", msg.Topic, msg.Group)
+	}
+
+	err := consumer.CommitMessages(ctx, kafka.Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit offset: %w", err)
+	}
+	consumer.markAcked(msg.Partition, msg.Offset)
+
+	return nil
+}
+
+// Defer lets the subscription go on past msg before it is acked
+func (b *Bus) Defer(ctx context.Context, msg bus.Message) error {
+	b.mu.Lock()
+	consumer, ok := b.consumers[subscriptionKey(msg.Group, msg.Topic)]
+	gen, owned := b.generations[msg.Group]
+	b.mu.Unlock()
+	if !ok && owned {
+		if gen.current(ctx, msg) {
+			gen.deferMessage(msg.Topic, msg.Partition, msg.Offset)
+		}
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("no subscription for %s in group %s", msg.Topic, msg.Group)
+	}
+
+	consumer.markDeferred(msg.Partition, msg.Offset)
+	return nil
+}
+
+// Close flushes and closes every producer
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var firstErr error
+	for topic, p := range b.producers {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(b.producers, topic)
+	}
+	return firstErr
+}
@@ -0,0 +1,147 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hamba/avro/v2"
+	"github.com/matthewhu/sportarbitrage/internal/schema"
+)
+
+// Headers describing how a message is encoded
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchemaSubject = "schema-subject"
+	HeaderSchemaVersion = "schema-version"
+
+	ContentTypeJSON = "application/json"
+	ContentTypeAvro = "application/avro"
+)
+
+// Codec encodes values for Kafka and decodes them again
+type Codec interface {
+	Encode(v interface{}) ([]byte, map[string]string, error)
+	Decode(data []byte, headers map[string]string, v interface{}) error
+}
+
+// JSONCodec encodes values as plain JSON, readable by anything
+type JSONCodec struct{}
+
+// Encode marshals v to JSON
+func (JSONCodec) Encode(v interface{}) ([]byte, map[string]string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return data, map[string]string{HeaderContentType: ContentTypeJSON}, nil
+}
+
+// Decode unmarshals JSON into v
+func (JSONCodec) Decode(data []byte, headers map[string]string, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// AvroCodec encodes values with the latest schema registered for their
+// type, and decodes data from any registered version into the latest
+type AvroCodec struct {
+	registry *schema.Registry
+}
+
+// NewAvroCodec creates an Avro codec backed by registry
+func NewAvroCodec(registry *schema.Registry) *AvroCodec {
+	return &AvroCodec{registry: registry}
+}
+
+// Encode writes v with its subject's latest schema
+func (c *AvroCodec) Encode(v interface{}) ([]byte, map[string]string, error) {
+	subject := schema.SubjectFor(v)
+	if subject == "" {
+		return nil, nil, fmt.Errorf("no schema for %T", v)
+	}
+
+	version, s, err := c.registry.Latest(subject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := avro.Marshal(s, v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode %s: %w", subject, err)
+	}
+
+	return data, map[string]string{
+		HeaderContentType:   ContentTypeAvro,
+		HeaderSchemaSubject: subject,
+		HeaderSchemaVersion: strconv.Itoa(version),
+	}, nil
+}
+
+// Decode reads data written with the version named in headers
+func (c *AvroCodec) Decode(data []byte, headers map[string]string, v interface{}) error {
+	subject := headers[HeaderSchemaSubject]
+	version, err := strconv.Atoi(headers[HeaderSchemaVersion])
+	if err != nil {
+		return fmt.Errorf("bad %s header %q", HeaderSchemaVersion, headers[HeaderSchemaVersion])
+	}
+
+	s, err := c.registry.Reader(subject, version)
+	if err != nil {
+		return err
+	}
+
+	if err := avro.Unmarshal(s, data, v); err != nil {
+		return fmt.Errorf("failed to decode %s v%d: %w", subject, version, err)
+	}
+	return nil
+}
+
+// Codecs encodes with one codec and decodes whichever one a message's
+// content-type header names. Values without a schema, and messages
+// without the header, fall back to JSON.
+type Codecs struct {
+	encoding string
+	json     JSONCodec
+	avro     *AvroCodec
+}
+
+// NewCodecs creates codecs that publish in encoding ("avro" or "json").
+// Schemas are read from schemaDir, or the ones built into the binary when
+// it is empty.
+func NewCodecs(encoding, schemaDir string) (*Codecs, error) {
+	if encoding != "avro" && encoding != "json" {
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+
+	var registry *schema.Registry
+	var err error
+	if schemaDir != "" {
+		registry, err = schema.NewFileRegistry(schemaDir)
+	} else {
+		registry, err = schema.Embedded()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schemas: %w", err)
+	}
+
+	return &Codecs{
+		encoding: encoding,
+		avro:     NewAvroCodec(registry),
+	}, nil
+}
+
+// Encode encodes v in the configured encoding
+func (c *Codecs) Encode(v interface{}) ([]byte, map[string]string, error) {
+	if c.encoding == "avro" && schema.SubjectFor(v) != "" {
+		return c.avro.Encode(v)
+	}
+	return c.json.Encode(v)
+}
+
+// Decode decodes data with the codec its headers name
+func (c *Codecs) Decode(data []byte, headers map[string]string, v interface{}) error {
+	if headers[HeaderContentType] == ContentTypeAvro {
+		return c.avro.Decode(data, headers, v)
+	}
+	return c.json.Decode(data, headers, v)
+}
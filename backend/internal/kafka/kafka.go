@@ -2,17 +2,21 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
 	"time"
 
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/telemetry"
 	"github.com/segmentio/kafka-go"
 )
 
 // Producer wraps Kafka writer
 type Producer struct {
 	writer *kafka.Writer
+	codec  Codec
 }
 
 // NewProducer creates a new Kafka producer
@@ -21,76 +25,188 @@ func NewProducer(brokers []string, topic string) *Producer {
 		writer: &kafka.Writer{
 			Addr:     kafka.TCP(brokers...),
 			Topic:    topic,
-			Balancer: &kafka.LeastBytes{},
+			Balancer: &kafka.Hash{}, // same key, same partition
 			BatchTimeout: 10 * time.Millisecond, // Send immediately for real-time
 		},
+		codec: JSONCodec{},
 	}
 }
 
-// Send publishes a message to Kafka
-func (p *Producer) Send(ctx context.Context, key string, value interface{}) error {
-	data, err := json.Marshal(value)
+// Send publishes a message to Kafka, with the headers set on ctx
+func (p *Producer) Send(ctx context.Context, key string, value interface{}) (err error) {
+	ctx, span := bus.StartPublish(ctx, p.writer.Topic)
+	defer func() { telemetry.End(span, err) }()
+
+	data, encoding, err := p.codec.Encode(value)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return err
+	}
+
+	headers := bus.PublishHeaders(ctx)
+	for k, v := range encoding {
+		headers[k] = v
 	}
 
 	err = p.writer.WriteMessages(ctx,
 		kafka.Message{
-			Key:   []byte(key),
-			Value: data,
+			Key:     []byte(key),
+			Value:   data,
+			Headers: toHeaders(headers),
 		},
 	)
 	
 	if err != nil {
+		metrics.PublishErrors.WithLabelValues(p.writer.Topic).Inc()
 		return fmt.Errorf("failed to write message: %w", err)
 	}
+	metrics.MessagesProduced.WithLabelValues(p.writer.Topic).Inc()
 	
 	return nil
 }
 
+// SendRaw publishes an already encoded message to Kafka
+func (p *Producer) SendRaw(ctx context.Context, key string, data []byte, headers map[string]string) error {
+	err := p.writer.WriteMessages(ctx,
+		kafka.Message{
+			Key:     []byte(key),
+			Value:   data,
+			Headers: toHeaders(headers),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
+
 // Close closes the producer
 func (p *Producer) Close() error {
 	return p.writer.Close()
 }
 
-// Consumer wraps Kafka reader
+func toHeaders(headers map[string]string) []kafka.Header {
+	var out []kafka.Header
+	for k, v := range headers {
+		out = append(out, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	return out
+}
+
+// Headers returns a message's headers as a map
+func Headers(msg kafka.Message) map[string]string {
+	out := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		out[h.Key] = string(h.Value)
+	}
+	return out
+}
+
+// Consumer wraps Kafka reader. Offsets are only committed through
+// CommitMessages, so a message fetched but never committed is delivered
+// again after a restart or rebalance.
 type Consumer struct {
 	reader *kafka.Reader
+
+	mu        sync.Mutex
+	committed map[int]int64 // highest committed offset per partition
+	deferrals map[int]int64 // highest offset per partition whose ack was deferred
+}
+
+// ConsumerOptions tune where a new group starts, how often commits are
+// flushed and how often an unacked message is redelivered
+type ConsumerOptions struct {
+	StartOffset    int64         // kafka.FirstOffset or kafka.LastOffset, for groups with no committed offset
+	CommitInterval time.Duration // zero commits synchronously on every CommitMessages
+	LagInterval    time.Duration // how often subscriptions log their lag, zero disables it
+	MaxDeliveries  int           // times SubscribeOwned delivers an unacked message before dead-lettering it, zero never does
 }
 
 // NewConsumer creates a new Kafka consumer
-func NewConsumer(brokers []string, topic, groupID string) *Consumer {
+func NewConsumer(brokers []string, topic, groupID string, opts ConsumerOptions) *Consumer {
 	return &Consumer{
 		reader: kafka.NewReader(kafka.ReaderConfig{
-			Brokers:     brokers,
-			Topic:       topic,
-			GroupID:     groupID,
-			MinBytes:    1,    // Read messages immediately
-			MaxBytes:    10e6, // 10MB
-			StartOffset: kafka.LastOffset,
+			Brokers:        brokers,
+			Topic:          topic,
+			GroupID:        groupID,
+			MinBytes:       1,    // Read messages immediately
+			MaxBytes:       10e6, // 10MB
+			StartOffset:    opts.StartOffset,
+			CommitInterval: opts.CommitInterval,
 		}),
+		committed: make(map[int]int64),
+		deferrals: make(map[int]int64),
+	}
+}
+
+// FetchMessage reads the next message without committing it
+func (c *Consumer) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	return c.reader.FetchMessage(ctx)
+}
+
+// CommitMessages marks msgs as processed. With a commit interval set the
+// offsets are flushed in the background, and on Close.
+func (c *Consumer) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	return c.reader.CommitMessages(ctx, msgs...)
+}
+
+// markAcked records that offset has been committed on partition
+func (c *Consumer) markAcked(partition int, offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.committed[partition]; !ok || offset > prev {
+		c.committed[partition] = offset
+	}
+}
+
+// markDeferred records that offset will be committed later
+func (c *Consumer) markDeferred(partition int, offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.deferrals[partition]; !ok || offset > prev {
+		c.deferrals[partition] = offset
+	}
+}
+
+// deferred returns the highest offset deferred on partition, or -1
+func (c *Consumer) deferred(partition int) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	offset, ok := c.deferrals[partition]
+	if !ok {
+		return -1
+	}
+	return offset
+}
+
+// acked returns the highest offset committed on partition, or -1
+func (c *Consumer) acked(partition int) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	offset, ok := c.committed[partition]
+	if !ok {
+		return -1
 	}
+	return offset
 }
 
-// ReadMessage reads a message from Kafka
-func (c *Consumer) ReadMessage(ctx context.Context) (kafka.Message, error) {
-	return c.reader.ReadMessage(ctx)
+// Lag returns how many messages the consumer is behind the partition head
+func (c *Consumer) Lag() int64 {
+	return c.reader.Stats().Lag
 }
 
-// Close closes the consumer
+// Close commits pending offsets and closes the consumer
 func (c *Consumer) Close() error {
 	return c.reader.Close()
 }
 
-// CreateTopics creates required Kafka topics
-func CreateTopics(brokers []string) error {
-	conn, err := kafka.Dial("tcp", brokers[0])
+// CreateTopics creates the given Kafka topics, leaving existing ones as they are
+func CreateTopics(ctx context.Context, brokers []string, topics []string) error {
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
 	if err != nil {
 		return fmt.Errorf("failed to connect to Kafka: %w", err)
 	}
 	defer conn.Close()
-
-	topics := []string{"odds-updates", "arbitrage-found", "odds-processed"}
 	
 	for _, topic := range topics {
 		topicConfig := kafka.TopicConfig{
@@ -101,11 +217,97 @@ func CreateTopics(brokers []string) error {
 
 		err = conn.CreateTopics(topicConfig)
 		if err != nil {
-			log.Printf("Topic %s might already exist: %v", topic, err)
+			slog.Info("Topic might already exist", "topic", topic, "error", err)
 		} else {
-			log.Printf("Created topic: %s", topic)
+			slog.Info("Created topic", "topic", topic)
 		}
 	}
 	
 	return nil
-}
\ No newline at end of file
+}
+
+// MissingTopics reports which of the given topics don't exist on the cluster yet
+func MissingTopics(ctx context.Context, brokers []string, topics []string) ([]string, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Kafka: %w", err)
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	existing := make(map[string]bool)
+	for _, p := range partitions {
+		existing[p.Topic] = true
+	}
+
+	var missing []string
+	for _, topic := range topics {
+		if !existing[topic] {
+			missing = append(missing, topic)
+		}
+	}
+
+	return missing, nil
+}
+
+// ReadTopic calls fn for every message currently on topic, partition by
+// partition, without joining a consumer group or committing offsets
+func ReadTopic(ctx context.Context, brokers []string, topic string, fn func(kafka.Message) error) error {
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return fmt.Errorf("failed to connect to Kafka: %w", err)
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read partitions of %s: %w", topic, err)
+	}
+
+	for _, p := range partitions {
+		leader, err := kafka.DialLeader(ctx, "tcp", brokers[0], topic, p.ID)
+		if err != nil {
+			return fmt.Errorf("failed to connect to leader of %s/%d: %w", topic, p.ID, err)
+		}
+		first, last, err := leader.ReadOffsets()
+		leader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read offsets of %s/%d: %w", topic, p.ID, err)
+		}
+		if first >= last {
+			continue
+		}
+
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:   brokers,
+			Topic:     topic,
+			Partition: p.ID,
+			MaxBytes:  10e6,
+		})
+		if err := reader.SetOffset(first); err != nil {
+			reader.Close()
+			return fmt.Errorf("failed to seek %s/%d: %w", topic, p.ID, err)
+		}
+
+		for {
+			msg, err := reader.ReadMessage(ctx)
+			if err != nil {
+				reader.Close()
+				return fmt.Errorf("failed to read %s/%d: %w", topic, p.ID, err)
+			}
+			if err := fn(msg); err != nil {
+				reader.Close()
+				return err
+			}
+			if msg.Offset >= last-1 {
+				break
+			}
+		}
+		reader.Close()
+	}
+
+	return nil
+}
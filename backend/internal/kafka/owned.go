@@ -0,0 +1,390 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+// ownedGeneration tracks one consumer group generation of a SubscribeOwned
+// member: the offsets acked so far and those still to be committed
+type ownedGeneration struct {
+	gen      *kafka.Generation
+	mu       sync.Mutex
+	acked    map[string]map[int]int64 // topic to partition to last acked offset
+	deferred map[string]map[int]int64 // topic to partition to last offset whose ack was deferred
+	pending  map[string]map[int]int64 // topic to partition to next offset to read
+	lag      map[string]map[int]int64
+}
+
+func newOwnedGeneration(gen *kafka.Generation) *ownedGeneration {
+	return &ownedGeneration{
+		gen:      gen,
+		acked:    make(map[string]map[int]int64),
+		deferred: make(map[string]map[int]int64),
+		pending:  make(map[string]map[int]int64),
+		lag:      make(map[string]map[int]int64),
+	}
+}
+
+// current reports whether msg was delivered in this generation. Its
+// offsets are only this generation's to commit if so; otherwise the
+// partition's next owner delivers msg again.
+func (g *ownedGeneration) current(ctx context.Context, msg bus.Message) bool {
+	if msg.Generation == int(g.gen.ID) {
+		return true
+	}
+	slog.DebugContext(ctx, "Dropping ack from an earlier generation",
+		append(msg.LogAttrs(), "group", msg.Group, "generation", msg.Generation, "current", g.gen.ID)...)
+	return false
+}
+
+func (g *ownedGeneration) ack(topic string, partition int, offset int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.acked[topic] == nil {
+		g.acked[topic] = make(map[int]int64)
+		g.pending[topic] = make(map[int]int64)
+	}
+	g.acked[topic][partition] = offset
+	g.pending[topic][partition] = offset + 1
+}
+
+func (g *ownedGeneration) deferMessage(topic string, partition int, offset int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.deferred[topic] == nil {
+		g.deferred[topic] = make(map[int]int64)
+	}
+	g.deferred[topic][partition] = offset
+}
+
+// settledOffset returns the last offset of a partition that was acked or
+// deferred, -1 if none
+func (g *ownedGeneration) settledOffset(topic string, partition int) int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	offset := int64(-1)
+	if acked, ok := g.acked[topic][partition]; ok {
+		offset = acked
+	}
+	if deferred, ok := g.deferred[topic][partition]; ok && deferred > offset {
+		offset = deferred
+	}
+	return offset
+}
+
+func (g *ownedGeneration) setLag(topic string, partition int, lag int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.lag[topic] == nil {
+		g.lag[topic] = make(map[int]int64)
+	}
+	g.lag[topic][partition] = lag
+}
+
+// commit sends the acked offsets to the group coordinator
+func (g *ownedGeneration) commit() error {
+	g.mu.Lock()
+	offsets := g.pending
+	g.pending = make(map[string]map[int]int64)
+	g.mu.Unlock()
+
+	if len(offsets) == 0 {
+		return nil
+	}
+	if err := g.gen.CommitOffsets(offsets); err != nil {
+		return fmt.Errorf("failed to commit offsets: %w", err)
+	}
+	return nil
+}
+
+// SubscribeOwned consumes topics as one member of group until ctx is
+// cancelled. The range balancer hands every member the same partition
+// numbers of each topic, so co-partitioned topics stay together.
+//
+// Each rebalance ends the current generation: its partitions finish the
+// message in hand, owner.Revoked runs, acked offsets are committed, and
+// the next generation's partitions go to owner.Assigned before any of
+// their messages are delivered.
+func (b *Bus) SubscribeOwned(ctx context.Context, group string, topics []string, handler bus.Handler, owner bus.Owner) error {
+	count, err := b.checkCoPartitioned(ctx, topics)
+	if err != nil {
+		return err
+	}
+	partitionOf := hashPartitioner(count)
+
+	cg, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:             group,
+		Brokers:        b.brokers,
+		Topics:         topics,
+		GroupBalancers: []kafka.GroupBalancer{kafka.RangeGroupBalancer{}},
+		StartOffset:    b.opts.StartOffset,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to join group %s: %w", group, err)
+	}
+	defer cg.Close()
+
+	logger := slog.With("group", group, "topics", topics)
+
+	for {
+		gen, err := cg.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logger.Warn("Error joining consumer group", "error", err)
+			continue
+		}
+
+		done := make(chan struct{})
+		gen.Start(func(genCtx context.Context) {
+			defer close(done)
+			b.runGeneration(ctx, genCtx, newOwnedGeneration(gen), group, handler, owner, partitionOf)
+		})
+
+		// The generation ends on a rebalance or when ctx is cancelled
+		select {
+		case <-done:
+		case <-ctx.Done():
+			<-done
+			return nil
+		}
+	}
+}
+
+// runGeneration consumes every assigned partition until the generation or
+// ctx ends, then hands the partitions back
+func (b *Bus) runGeneration(ctx, genCtx context.Context, g *ownedGeneration, group string, handler bus.Handler, owner bus.Owner, partitionOf bus.Partitioner) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-genCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Partition numbers are the same across co-partitioned topics
+	seen := make(map[int]bool)
+	var partitions []int
+	for _, assignments := range g.gen.Assignments {
+		for _, a := range assignments {
+			if !seen[a.ID] {
+				seen[a.ID] = true
+				partitions = append(partitions, a.ID)
+			}
+		}
+	}
+	sort.Ints(partitions)
+
+	logger := slog.With("group", group, "generation", g.gen.ID, "partitions", partitions)
+	if err := owner.Assigned(ctx, partitions, partitionOf); err != nil {
+		// Leaving the generation makes the group rebalance and try again
+		logger.Error("Error taking ownership of partitions", "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(1 * time.Second):
+		}
+		return
+	}
+	logger.Info("Partitions assigned")
+
+	b.mu.Lock()
+	b.generations[group] = g
+	b.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for topic, assignments := range g.gen.Assignments {
+		for _, a := range assignments {
+			wg.Add(1)
+			go func(topic string, a kafka.PartitionAssignment) {
+				defer wg.Done()
+				b.consumePartition(ctx, g, group, topic, a, handler)
+			}(topic, a)
+		}
+	}
+
+	// Commit acked offsets as they build up, like a group reader does
+	commitDone := make(chan struct{})
+	go func() {
+		defer close(commitDone)
+		b.commitLoop(ctx, g, group)
+	}()
+
+	wg.Wait()
+	<-commitDone
+
+	b.mu.Lock()
+	if b.generations[group] == g {
+		delete(b.generations, group)
+	}
+	b.mu.Unlock()
+
+	// Save state before committing, so it is never behind the offsets
+	owner.Revoked(context.WithoutCancel(ctx), partitions)
+	if err := g.commit(); err != nil {
+		logger.Warn("Error committing offsets on revoke", "error", err)
+	}
+	logger.Info("Partitions revoked")
+}
+
+// consumePartition feeds one partition to handler. A message left unacked
+// is read again, along with everything after it, until it has been
+// delivered MaxDeliveries times; then it goes to the dead-letter topic and
+// the partition moves on.
+func (b *Bus) consumePartition(ctx context.Context, g *ownedGeneration, group, topic string, a kafka.PartitionAssignment, handler bus.Handler) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   b.brokers,
+		Topic:     topic,
+		Partition: a.ID,
+	})
+	defer reader.Close()
+
+	logger := slog.With("topic", topic, "partition", a.ID, "group", group)
+	if err := reader.SetOffset(a.Offset); err != nil {
+		logger.Error("Error seeking to assigned offset", "offset", a.Offset, "error", err)
+		return
+	}
+
+	// Deliveries of the message the partition was last rewound to
+	var retrying int64 = -1
+	deliveries := 0
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("Error reading message", "error", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		metrics.MessagesConsumed.WithLabelValues(topic, group).Inc()
+		g.setLag(topic, a.ID, reader.Lag())
+
+		delivered := bus.Message{
+			Topic:      msg.Topic,
+			Key:        string(msg.Key),
+			Value:      msg.Value,
+			Headers:    Headers(msg),
+			Partition:  msg.Partition,
+			Offset:     msg.Offset,
+			Timestamp:  msg.Time,
+			Group:      group,
+			Generation: int(g.gen.ID),
+			Decoder:    b.codecs,
+		}
+		handler(ctx, delivered)
+
+		if g.settledOffset(topic, a.ID) < msg.Offset {
+			if msg.Offset != retrying {
+				retrying, deliveries = msg.Offset, 0
+			}
+			deliveries++
+			if b.opts.MaxDeliveries > 0 && deliveries >= b.opts.MaxDeliveries {
+				cause := fmt.Errorf("not acked after %d deliveries", deliveries)
+				if err := bus.PublishDeadLetter(ctx, b, group, delivered, cause); err == nil {
+					g.ack(topic, a.ID, msg.Offset)
+					continue
+				}
+			}
+
+			logger.Warn("Rewinding partition", "offset", msg.Offset, "deliveries", deliveries)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(1 * time.Second):
+			}
+			if err := reader.SetOffset(msg.Offset); err != nil {
+				logger.Error("Error rewinding partition", "offset", msg.Offset, "error", err)
+				return
+			}
+		}
+	}
+}
+
+func (b *Bus) commitLoop(ctx context.Context, g *ownedGeneration, group string) {
+	interval := b.opts.CommitInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := g.commit(); err != nil {
+			slog.Warn("Error committing offsets", "group", group, "error", err)
+		}
+
+		g.mu.Lock()
+		for topic, partitions := range g.lag {
+			var total int64
+			for _, lag := range partitions {
+				total += lag
+			}
+			metrics.ConsumerLag.WithLabelValues(topic, group).Set(float64(total))
+		}
+		g.mu.Unlock()
+	}
+}
+
+// checkCoPartitioned makes sure topics have the same number of partitions,
+// otherwise a key would land on different partition numbers, and returns it
+func (b *Bus) checkCoPartitioned(ctx context.Context, topics []string) (int, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", b.brokers[0])
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to Kafka: %w", err)
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(topics...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read partitions: %w", err)
+	}
+	counts := make(map[string]int)
+	for _, p := range partitions {
+		counts[p.Topic]++
+	}
+	for _, topic := range topics[1:] {
+		if counts[topic] != counts[topics[0]] {
+			return 0, fmt.Errorf("%s has %d partitions but %s has %d, they must match",
+				topic, counts[topic], topics[0], counts[topics[0]])
+		}
+	}
+	return counts[topics[0]], nil
+}
+
+// hashPartitioner maps keys to partitions the way the producer's hash
+// balancer does for topics with count partitions
+func hashPartitioner(count int) bus.Partitioner {
+	partitions := make([]int, count)
+	for i := range partitions {
+		partitions[i] = i
+	}
+	balancer := &kafka.Hash{}
+	return func(key string) int {
+		return balancer.Balance(kafka.Message{Key: []byte(key)}, partitions...)
+	}
+}
@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sportarbitrage"
+
+// latencyBuckets cover sub-millisecond Redis calls up to multi-second fetches
+var latencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Fetcher
+var (
+	FetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fetch_duration_seconds",
+		Help:      "Time taken to fetch odds from a sportsbook.",
+		Buckets:   latencyBuckets,
+	}, []string{"sportsbook"})
+
+	FetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fetch_errors_total",
+		Help:      "Failed fetches per sportsbook.",
+	}, []string{"sportsbook"})
+)
+
+// Bus
+var (
+	MessagesProduced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_produced_total",
+		Help:      "Messages published per topic.",
+	}, []string{"topic"})
+
+	PublishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "publish_errors_total",
+		Help:      "Failed publishes per topic.",
+	}, []string{"topic"})
+
+	MessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_consumed_total",
+		Help:      "Messages delivered to handlers per topic and consumer group.",
+	}, []string{"topic", "group"})
+
+	ConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "consumer_lag_messages",
+		Help:      "How far a consumer group is behind the head of the topic.",
+	}, []string{"topic", "group"})
+
+	DeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dead_letters_total",
+		Help:      "Messages routed to a dead-letter topic, by source topic and rejecting service.",
+	}, []string{"topic", "service"})
+)
+
+// Detector
+var (
+	DetectionDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "detection_duration_seconds",
+		Help:      "Time spent checking one odds update against the cached quotes.",
+		Buckets:   latencyBuckets,
+	})
+
+	DetectionLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "detection_latency_seconds",
+		Help:      "Time from the bookmaker fetch to an opportunity being detected.",
+		Buckets:   latencyBuckets,
+	})
+
+	ArbitrageFound = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "arbitrage_found_total",
+		Help:      "Opportunities opened, by sport and the pair of books involved.",
+	}, []string{"sport", "book_pair"})
+
+	ArbitrageLifetime = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "arbitrage_lifetime_seconds",
+		Help:      "Time from an opportunity opening to closing, by close reason.",
+		Buckets:   []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800},
+	}, []string{"reason"})
+)
+
+// API
+var (
+	WebSocketClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_clients",
+		Help:      "Connected WebSocket clients.",
+	})
+
+	BroadcastDrops = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "broadcast_drops_total",
+		Help:      "Opportunities dropped because the broadcast channel was full.",
+	})
+
+	PushLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "push_latency_seconds",
+		Help:      "Time from the bookmaker fetch to the WebSocket push.",
+		Buckets:   latencyBuckets,
+	})
+)
+
+// Postgres writers
+var (
+	RowsWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "postgres_rows_written_total",
+		Help:      "Rows written by batch writers, by table.",
+	}, []string{"table"})
+
+	WriteErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "postgres_write_errors_total",
+		Help:      "Failed batch writes, each retried later, by table.",
+	}, []string{"table"})
+
+	RowsBuffered = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "postgres_rows_buffered",
+		Help:      "Rows consumed but not yet written, by table.",
+	}, []string{"table"})
+
+	RowsSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "postgres_rows_skipped_total",
+		Help:      "Rows consumed but not written as there is no partition for them, by table and reason.",
+	}, []string{"table", "reason"})
+)
+
+// Redis
+var RedisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "redis_operation_duration_seconds",
+	Help:      "Redis command latency by command, pipelines as one operation.",
+	Buckets:   latencyBuckets,
+}, []string{"operation"})
+
+// Handler serves every registered metric in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -4,42 +4,86 @@ import (
 	"time"
 )
 
-// OddsUpdate represents odds from a sportsbook
+// OddsUpdate represents odds from a sportsbook. Its avro tags follow the
+// odds-update schema in internal/schema.
 type OddsUpdate struct {
-	ID         string    `json:"id"`
-	EventID    string    `json:"event_id"`
-	Sport      string    `json:"sport"`
-	HomeTeam   string    `json:"home_team"`
-	AwayTeam   string    `json:"away_team"`
-	Bookmaker  string    `json:"bookmaker"`
-	HomeOdds   float64   `json:"home_odds"`
-	AwayOdds   float64   `json:"away_odds"`
-	DrawOdds   float64   `json:"draw_odds,omitempty"`
-	Timestamp  time.Time `json:"timestamp"`
-	MarketType string    `json:"market_type"` // moneyline, spread, total
+	ID         string    `json:"id" avro:"id"`
+	EventID    string    `json:"event_id" avro:"event_id"`
+	Sport      string    `json:"sport" avro:"sport"`
+	HomeTeam   string    `json:"home_team" avro:"home_team"`
+	AwayTeam   string    `json:"away_team" avro:"away_team"`
+	Bookmaker  string    `json:"bookmaker" avro:"bookmaker"`
+	HomeOdds   float64   `json:"home_odds" avro:"home_odds"`
+	AwayOdds   float64   `json:"away_odds" avro:"away_odds"`
+	DrawOdds   float64   `json:"draw_odds,omitempty" avro:"draw_odds"`
+	Timestamp  time.Time `json:"timestamp" avro:"timestamp"`
+	MarketType string    `json:"market_type" avro:"market_type"`           // moneyline, spread, total
+	OddsFormat string    `json:"odds_format,omitempty" avro:"odds_format"` // decimal (or empty), american, hongkong
 }
 
-// ArbitrageOpportunity represents a profitable betting opportunity
+// ArbitrageOpportunity represents a profitable betting opportunity. Its
+// avro tags follow the arbitrage-opportunity schema in internal/schema.
+//
+// An opportunity keeps its ID for as long as its event, market and legs
+// stay profitable. It is published once when it opens, again whenever its
+// profit changes, and a last time when it closes.
 type ArbitrageOpportunity struct {
-	ID             string    `json:"id"`
-	EventID        string    `json:"event_id"`
-	Sport          string    `json:"sport"`
-	HomeTeam       string    `json:"home_team"`
-	AwayTeam       string    `json:"away_team"`
-	BookmakerHome  string    `json:"bookmaker_home"`
-	BookmakerAway  string    `json:"bookmaker_away"`
-	HomeOdds       float64   `json:"home_odds"`
-	AwayOdds       float64   `json:"away_odds"`
-	ProfitPercent  float64   `json:"profit_percent"`
-	HomeStake      float64   `json:"home_stake"`
-	AwayStake      float64   `json:"away_stake"`
-	TotalStake     float64   `json:"total_stake"`
-	ExpectedReturn float64   `json:"expected_return"`
-	CreatedAt      time.Time `json:"created_at"`
-	ExpiresAt      time.Time `json:"expires_at"`
-	Status         string    `json:"status"` // active, expired, executed
+	ID             string    `json:"id" avro:"id"`
+	EventID        string    `json:"event_id" avro:"event_id"`
+	Sport          string    `json:"sport" avro:"sport"`
+	HomeTeam       string    `json:"home_team" avro:"home_team"`
+	AwayTeam       string    `json:"away_team" avro:"away_team"`
+	BookmakerHome  string    `json:"bookmaker_home" avro:"bookmaker_home"`
+	BookmakerAway  string    `json:"bookmaker_away" avro:"bookmaker_away"`
+	HomeOdds       float64   `json:"home_odds" avro:"home_odds"`
+	AwayOdds       float64   `json:"away_odds" avro:"away_odds"`
+	ProfitPercent  float64   `json:"profit_percent" avro:"profit_percent"`
+	HomeStake      float64   `json:"home_stake" avro:"home_stake"`
+	AwayStake      float64   `json:"away_stake" avro:"away_stake"`
+	TotalStake     float64   `json:"total_stake" avro:"total_stake"`
+	ExpectedReturn float64   `json:"expected_return" avro:"expected_return"`
+	CreatedAt      time.Time `json:"created_at" avro:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at" avro:"expires_at"`
+	Status         string    `json:"status" avro:"status"`         // active, expired, executed
+	Live           bool      `json:"live" avro:"live"`             // detected in-play rather than pre-match
+	Confidence     float64   `json:"confidence" avro:"confidence"` // 0-1, lower when the legs were quoted further apart
+	MarketType     string    `json:"market_type" avro:"market_type"`
+	Event          string    `json:"event" avro:"event"` // opened, updated or closed
+	UpdatedAt      time.Time `json:"updated_at" avro:"updated_at"`
+	CloseReason    string    `json:"close_reason,omitempty" avro:"close_reason"`
+	Lifetime       float64   `json:"lifetime_seconds,omitempty" avro:"lifetime_seconds"` // from opening to closing
 }
 
+// Opportunity statuses
+const (
+	OpportunityActive   = "active"
+	OpportunityExpired  = "expired"
+	OpportunityExecuted = "executed"
+)
+
+// Opportunity lifecycle events
+const (
+	OpportunityOpened  = "opened"
+	OpportunityUpdated = "updated" // the profit changed
+	OpportunityClosed  = "closed"
+)
+
+// Reasons an opportunity closes
+const (
+	CloseReasonPricesMoved = "prices_moved" // a leg requoted and the pair is no longer profitable
+	CloseReasonStale       = "stale"        // a leg's quote is gone or older than the freshness window
+	CloseReasonExpired     = "expired"      // no leg requoted before the opportunity expired
+	CloseReasonEventLive   = "event_live"   // pre-match quotes were discarded as the event went in-play
+	CloseReasonEventEnded  = "event_ended"  // the event is no longer tracked
+)
+
+// Event statuses, in the only order an event may move through them
+const (
+	EventStatusUpcoming = "upcoming"
+	EventStatusLive     = "live"
+	EventStatusFinal    = "final"
+)
+
 // Event represents a sporting event
 type Event struct {
 	ID        string    `json:"id"`
@@ -48,12 +92,22 @@ type Event struct {
 	HomeTeam  string    `json:"home_team"`
 	AwayTeam  string    `json:"away_team"`
 	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"` // zero unless the schedule gives one
 	Status    string    `json:"status"`
 }
 
+// EventLifecycle is published whenever an event changes status
+type EventLifecycle struct {
+	EventID        string    `json:"event_id"`
+	Event          Event     `json:"event"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Status         string    `json:"status"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
 // WebSocketMessage for real-time updates
 type WebSocketMessage struct {
-	Type      string      `json:"type"` // arbitrage, odds_update, status
+	Type      string      `json:"type"` // arbitrage, arbitrage_removed, odds_update, status
 	Data      interface{} `json:"data"`
 	Timestamp time.Time   `json:"timestamp"`
 }
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Validate checks the fields the detector relies on
+func (o *OddsUpdate) Validate() error {
+	if o.EventID == "" {
+		return fmt.Errorf("event_id is required")
+	}
+	if o.Bookmaker == "" {
+		return fmt.Errorf("bookmaker is required")
+	}
+	if o.HomeOdds <= 1 || o.AwayOdds <= 1 {
+		return fmt.Errorf("decimal odds must be greater than 1, got %.2f/%.2f", o.HomeOdds, o.AwayOdds)
+	}
+	if o.Timestamp.IsZero() {
+		return fmt.Errorf("timestamp is required")
+	}
+	return nil
+}
+
+// Validate checks the fields clients rely on
+func (a *ArbitrageOpportunity) Validate() error {
+	if a.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if a.EventID == "" {
+		return fmt.Errorf("event_id is required")
+	}
+	if a.ExpiresAt.IsZero() {
+		return fmt.Errorf("expires_at is required")
+	}
+	return nil
+}
+
+// Validate checks the message names an event and a known status
+func (e *EventLifecycle) Validate() error {
+	if e.EventID == "" {
+		return fmt.Errorf("event_id is required")
+	}
+	switch e.Status {
+	case EventStatusUpcoming, EventStatusLive, EventStatusFinal:
+	default:
+		return fmt.Errorf("unknown status %q", e.Status)
+	}
+	return nil
+}
+
+// DeadLetter wraps a message that could not be processed, with enough
+// context to find the bug and replay it onto its original topic
+type DeadLetter struct {
+	Service   string            `json:"service"`
+	Error     string            `json:"error"`
+	Topic     string            `json:"topic"`
+	Partition int               `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Key       string            `json:"key"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Payload   []byte            `json:"payload"` // the original bytes, base64 in JSON
+	FailedAt  time.Time         `json:"failed_at"`
+}
@@ -0,0 +1,164 @@
+package normalizer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/startup"
+)
+
+// Normalizer reads raw odds from the fetchers, cleans them and publishes
+// the survivors to the processed odds topic for the detector
+type Normalizer struct {
+	cfg    *config.Config
+	bus    bus.Bus
+	rules  *Rules
+	ctx    context.Context
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	seen   map[string]time.Time // update ID to when it was first seen
+	latest map[string]time.Time // event:book:market to newest quote timestamp
+}
+
+// NewNormalizer creates a normalizer reading from and publishing to b
+func NewNormalizer(cfg *config.Config, b bus.Bus) *Normalizer {
+	return &Normalizer{
+		cfg:    cfg,
+		bus:    b,
+		rules:  NewRules(cfg.Normalizer),
+		ctx:    bus.WithProducer(context.Background(), "normalizer"),
+		logger: slog.With("component", "normalizer"),
+		seen:   make(map[string]time.Time),
+		latest: make(map[string]time.Time),
+	}
+}
+
+// Run normalizes odds until ctx is cancelled. The update in hand is
+// published on n.ctx, which outlives ctx by the shutdown timeout.
+func (n *Normalizer) Run(ctx context.Context) {
+	n.logger.Info("Starting odds normalizer")
+	n.ctx = bus.WithProducer(startup.DrainContext(ctx, n.cfg.HTTP.ShutdownTimeout.Duration), "normalizer")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		n.cleanup(ctx)
+	}()
+
+	topics, groups := n.cfg.Kafka.Topics, n.cfg.Kafka.Groups
+	if err := n.bus.Subscribe(ctx, topics.OddsUpdates, groups.Normalizer, n.handleOdds); err != nil {
+		n.logger.Error("Odds subscription ended", "error", err)
+	}
+
+	wg.Wait()
+}
+
+// handleOdds publishes the cleaned update, dead-letters one that fails
+// validation and acks duplicates without republishing them
+func (n *Normalizer) handleOdds(ctx context.Context, msg bus.Message) {
+	spanCtx, span := bus.StartConsume(n.ctx, msg)
+	defer span.End()
+
+	var odds models.OddsUpdate
+	if err := msg.Decode(&odds); err != nil {
+		bus.DeadLetter(ctx, n.bus, "normalizer", msg, fmt.Errorf("failed to parse odds: %w", err))
+		return
+	}
+	if err := n.rules.Apply(&odds); err != nil {
+		bus.DeadLetter(ctx, n.bus, "normalizer", msg, fmt.Errorf("rejected odds: %w", err))
+		return
+	}
+	if err := odds.Validate(); err != nil {
+		bus.DeadLetter(ctx, n.bus, "normalizer", msg, fmt.Errorf("invalid odds: %w", err))
+		return
+	}
+
+	if n.duplicate(&odds) {
+		n.ack(ctx, msg)
+		return
+	}
+
+	if err := n.bus.Publish(spanCtx, n.cfg.Kafka.Topics.OddsProcessed, odds.EventID, &odds); err != nil {
+		n.logger.ErrorContext(spanCtx, "Error publishing processed odds", append(msg.LogAttrs(),
+			"event_id", odds.EventID, "book", odds.Bookmaker, "error", err)...)
+		n.forget(&odds)
+		return
+	}
+
+	n.ack(ctx, msg)
+}
+
+func (n *Normalizer) ack(ctx context.Context, msg bus.Message) {
+	if err := n.bus.Ack(ctx, msg); err != nil {
+		n.logger.ErrorContext(ctx, "Error acking message", append(msg.LogAttrs(), "error", err)...)
+	}
+}
+
+func quoteKey(odds *models.OddsUpdate) string {
+	return odds.EventID + ":" + odds.Bookmaker + ":" + odds.MarketType
+}
+
+// duplicate reports whether odds was already published, or is older than
+// a quote already published for the same market, and records it if not
+func (n *Normalizer) duplicate(odds *models.OddsUpdate) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.seen[odds.ID]; ok {
+		return true
+	}
+	key := quoteKey(odds)
+	if last, ok := n.latest[key]; ok && !odds.Timestamp.After(last) {
+		return true
+	}
+
+	n.seen[odds.ID] = time.Now()
+	n.latest[key] = odds.Timestamp
+	return false
+}
+
+// forget undoes duplicate's bookkeeping so a redelivery is published
+func (n *Normalizer) forget(odds *models.OddsUpdate) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.seen, odds.ID)
+	delete(n.latest, quoteKey(odds))
+}
+
+// cleanup drops dedupe entries older than the window
+func (n *Normalizer) cleanup(ctx context.Context) {
+	window := n.cfg.Normalizer.DedupeWindow.Duration
+	ticker := time.NewTicker(window / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n.mu.Lock()
+		cutoff := time.Now().Add(-window)
+		for id, seenAt := range n.seen {
+			if seenAt.Before(cutoff) {
+				delete(n.seen, id)
+			}
+		}
+		for key, ts := range n.latest {
+			if ts.Before(cutoff) {
+				delete(n.latest, key)
+			}
+		}
+		n.mu.Unlock()
+	}
+}
@@ -0,0 +1,138 @@
+package normalizer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// Odds formats a fetcher may publish in
+const (
+	FormatDecimal  = "decimal"
+	FormatAmerican = "american"
+	FormatHongKong = "hongkong"
+)
+
+// Rules canonicalizes and validates a single odds update
+type Rules struct {
+	minOverround  float64
+	maxOverround  float64
+	teamAliases   map[string]string
+	marketAliases map[string]string
+}
+
+// NewRules creates rules from the normalizer settings
+func NewRules(cfg config.NormalizerConfig) *Rules {
+	return &Rules{
+		minOverround:  cfg.MinOverround,
+		maxOverround:  cfg.MaxOverround,
+		teamAliases:   lowerKeys(cfg.TeamAliases),
+		marketAliases: lowerKeys(cfg.MarketAliases),
+	}
+}
+
+func lowerKeys(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	return out
+}
+
+// Apply rewrites odds into canonical form: decimal prices, canonical team
+// names, sport and market type. The event ID is the catalogue's, which
+// fetchers quote against, so it is kept as published; lifecycle messages,
+// stored events and the fetchers' cached quotes all use it.
+// It returns an error if the update can't be trusted.
+func (r *Rules) Apply(odds *models.OddsUpdate) error {
+	// Convert prices to decimal
+	format := strings.ToLower(odds.OddsFormat)
+	var err error
+	if odds.HomeOdds, err = toDecimal(odds.HomeOdds, format); err != nil {
+		return fmt.Errorf("home odds: %w", err)
+	}
+	if odds.AwayOdds, err = toDecimal(odds.AwayOdds, format); err != nil {
+		return fmt.Errorf("away odds: %w", err)
+	}
+	if odds.DrawOdds != 0 {
+		if odds.DrawOdds, err = toDecimal(odds.DrawOdds, format); err != nil {
+			return fmt.Errorf("draw odds: %w", err)
+		}
+	}
+	odds.OddsFormat = FormatDecimal
+
+	// Reject prices no book would offer
+	for _, price := range []float64{odds.HomeOdds, odds.AwayOdds} {
+		if math.IsNaN(price) || math.IsInf(price, 0) || price <= 1.0 {
+			return fmt.Errorf("invalid decimal odds %v", price)
+		}
+	}
+	overround := 1/odds.HomeOdds + 1/odds.AwayOdds
+	if odds.DrawOdds != 0 {
+		if odds.DrawOdds <= 1.0 || math.IsNaN(odds.DrawOdds) || math.IsInf(odds.DrawOdds, 0) {
+			return fmt.Errorf("invalid decimal odds %v", odds.DrawOdds)
+		}
+		overround += 1 / odds.DrawOdds
+	}
+	if overround < r.minOverround || overround > r.maxOverround {
+		return fmt.Errorf("overround %.3f outside [%.2f, %.2f]", overround, r.minOverround, r.maxOverround)
+	}
+
+	// Canonicalize names
+	odds.HomeTeam = r.team(odds.HomeTeam)
+	odds.AwayTeam = r.team(odds.AwayTeam)
+	if odds.HomeTeam == "" || odds.AwayTeam == "" {
+		return fmt.Errorf("both teams are required")
+	}
+	odds.Sport = strings.ToUpper(strings.TrimSpace(odds.Sport))
+	odds.Bookmaker = strings.ToLower(strings.TrimSpace(odds.Bookmaker))
+	odds.MarketType = r.market(odds.MarketType)
+	if strings.TrimSpace(odds.EventID) == "" {
+		return fmt.Errorf("event ID is required")
+	}
+
+	return nil
+}
+
+// team collapses whitespace and maps known aliases to the canonical name
+func (r *Rules) team(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if canonical, ok := r.teamAliases[strings.ToLower(name)]; ok {
+		return canonical
+	}
+	return name
+}
+
+// market maps the market type to its canonical name, moneyline if unset
+func (r *Rules) market(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if canonical, ok := r.marketAliases[name]; ok {
+		return canonical
+	}
+	if name == "" {
+		return "moneyline"
+	}
+	return name
+}
+
+// toDecimal converts a price in format to decimal odds
+func toDecimal(price float64, format string) (float64, error) {
+	switch format {
+	case "", FormatDecimal:
+		return price, nil
+	case FormatAmerican:
+		switch {
+		case price >= 100:
+			return 1 + price/100, nil
+		case price <= -100:
+			return 1 + 100/-price, nil
+		}
+		return 0, fmt.Errorf("invalid american odds %v", price)
+	case FormatHongKong:
+		return price + 1, nil
+	}
+	return 0, fmt.Errorf("unknown odds format %q", format)
+}
@@ -0,0 +1,251 @@
+package normalizer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+func TestToDecimal(t *testing.T) {
+	tests := []struct {
+		name    string
+		price   float64
+		format  string
+		want    float64
+		wantErr bool
+	}{
+		{name: "decimal", price: 2.5, format: FormatDecimal, want: 2.5},
+		{name: "no format is decimal", price: 1.91, format: "", want: 1.91},
+		{name: "american underdog", price: 150, format: FormatAmerican, want: 2.5},
+		{name: "american even", price: 100, format: FormatAmerican, want: 2},
+		{name: "american even, negative", price: -100, format: FormatAmerican, want: 2},
+		{name: "american favourite", price: -200, format: FormatAmerican, want: 1.5},
+		{name: "american between -100 and 100", price: 50, format: FormatAmerican, wantErr: true},
+		{name: "hong kong", price: 0.8, format: FormatHongKong, want: 1.8},
+		{name: "unknown format", price: 2, format: "fractional", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toDecimal(tt.price, tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("toDecimal(%v, %q) = %v, want an error", tt.price, tt.format, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("toDecimal(%v, %q): %v", tt.price, tt.format, err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("toDecimal(%v, %q) = %v, want %v", tt.price, tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesApply(t *testing.T) {
+	rules := NewRules(config.Default().Normalizer)
+
+	// update is a fair two-way decimal quote for the test to adjust
+	update := func(adjust func(o *models.OddsUpdate)) *models.OddsUpdate {
+		o := &models.OddsUpdate{
+			EventID:   "book-event-1",
+			Sport:     "nba",
+			HomeTeam:  "Lakers",
+			AwayTeam:  "Celtics",
+			Bookmaker: "BookA",
+			HomeOdds:  1.9,
+			AwayOdds:  1.9,
+		}
+		adjust(o)
+		return o
+	}
+
+	tests := []struct {
+		name    string
+		odds    *models.OddsUpdate
+		want    *models.OddsUpdate
+		wantErr bool
+	}{
+		{
+			name: "canonical names",
+			odds: update(func(o *models.OddsUpdate) {
+				o.Sport = " nba "
+				o.Bookmaker = " BookA "
+			}),
+			want: update(func(o *models.OddsUpdate) {
+				o.Sport = "NBA"
+				o.Bookmaker = "booka"
+				o.MarketType = "moneyline"
+				o.OddsFormat = FormatDecimal
+			}),
+		},
+		{
+			name: "team aliases are case-insensitive after collapsing whitespace",
+			odds: update(func(o *models.OddsUpdate) {
+				o.HomeTeam = "  Los   Angeles LAKERS "
+				o.AwayTeam = "Boston Celtics"
+			}),
+			want: update(func(o *models.OddsUpdate) {
+				o.Sport = "NBA"
+				o.Bookmaker = "booka"
+				o.MarketType = "moneyline"
+				o.OddsFormat = FormatDecimal
+			}),
+		},
+		{
+			name: "unknown teams keep their name",
+			odds: update(func(o *models.OddsUpdate) {
+				o.HomeTeam = "Miami  Heat"
+			}),
+			want: update(func(o *models.OddsUpdate) {
+				o.HomeTeam = "Miami Heat"
+				o.Sport = "NBA"
+				o.Bookmaker = "booka"
+				o.MarketType = "moneyline"
+				o.OddsFormat = FormatDecimal
+			}),
+		},
+		{
+			name: "market aliases",
+			odds: update(func(o *models.OddsUpdate) {
+				o.MarketType = " Over/Under "
+			}),
+			want: update(func(o *models.OddsUpdate) {
+				o.Sport = "NBA"
+				o.Bookmaker = "booka"
+				o.MarketType = "total"
+				o.OddsFormat = FormatDecimal
+			}),
+		},
+		{
+			name: "unknown market types are lowercased",
+			odds: update(func(o *models.OddsUpdate) {
+				o.MarketType = "Props"
+			}),
+			want: update(func(o *models.OddsUpdate) {
+				o.Sport = "NBA"
+				o.Bookmaker = "booka"
+				o.MarketType = "props"
+				o.OddsFormat = FormatDecimal
+			}),
+		},
+		{
+			name: "the catalogue's event ID is kept for aliased teams",
+			odds: update(func(o *models.OddsUpdate) {
+				o.EventID = "la-lakers-vs-celtics-20260301-1900"
+				o.HomeTeam = "LA Lakers"
+			}),
+			want: update(func(o *models.OddsUpdate) {
+				o.EventID = "la-lakers-vs-celtics-20260301-1900"
+				o.Sport = "NBA"
+				o.Bookmaker = "booka"
+				o.MarketType = "moneyline"
+				o.OddsFormat = FormatDecimal
+			}),
+		},
+		{
+			name: "american prices with a draw",
+			odds: update(func(o *models.OddsUpdate) {
+				o.OddsFormat = "AMERICAN"
+				o.HomeOdds, o.AwayOdds, o.DrawOdds = 150, 200, 250
+			}),
+			want: update(func(o *models.OddsUpdate) {
+				o.Sport = "NBA"
+				o.Bookmaker = "booka"
+				o.MarketType = "moneyline"
+				o.OddsFormat = FormatDecimal
+				o.HomeOdds, o.AwayOdds, o.DrawOdds = 2.5, 3, 3.5
+			}),
+		},
+		{
+			name: "hong kong prices",
+			odds: update(func(o *models.OddsUpdate) {
+				o.OddsFormat = FormatHongKong
+				o.HomeOdds, o.AwayOdds = 0.9, 0.9
+			}),
+			want: update(func(o *models.OddsUpdate) {
+				o.Sport = "NBA"
+				o.Bookmaker = "booka"
+				o.MarketType = "moneyline"
+				o.OddsFormat = FormatDecimal
+			}),
+		},
+		{
+			name:    "unknown format",
+			odds:    update(func(o *models.OddsUpdate) { o.OddsFormat = "fractional" }),
+			wantErr: true,
+		},
+		{
+			name: "invalid american draw",
+			odds: update(func(o *models.OddsUpdate) {
+				o.OddsFormat = FormatAmerican
+				o.HomeOdds, o.AwayOdds, o.DrawOdds = 150, 150, 20
+			}),
+			wantErr: true,
+		},
+		{
+			name:    "decimal price of one",
+			odds:    update(func(o *models.OddsUpdate) { o.HomeOdds = 1 }),
+			wantErr: true,
+		},
+		{
+			name:    "NaN price",
+			odds:    update(func(o *models.OddsUpdate) { o.AwayOdds = math.NaN() }),
+			wantErr: true,
+		},
+		{
+			name:    "overround too low",
+			odds:    update(func(o *models.OddsUpdate) { o.HomeOdds, o.AwayOdds = 3, 3 }),
+			wantErr: true,
+		},
+		{
+			name:    "overround too high",
+			odds:    update(func(o *models.OddsUpdate) { o.HomeOdds, o.AwayOdds = 1.2, 1.2 }),
+			wantErr: true,
+		},
+		{
+			name:    "missing event ID",
+			odds:    update(func(o *models.OddsUpdate) { o.EventID = "" }),
+			wantErr: true,
+		},
+		{
+			name:    "missing team",
+			odds:    update(func(o *models.OddsUpdate) { o.AwayTeam = "  " }),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rules.Apply(tt.odds)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Apply() succeeded with %+v, want an error", *tt.odds)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply(): %v", err)
+			}
+
+			got := *tt.odds
+			for _, p := range []struct{ got, want *float64 }{
+				{&got.HomeOdds, &tt.want.HomeOdds},
+				{&got.AwayOdds, &tt.want.AwayOdds},
+				{&got.DrawOdds, &tt.want.DrawOdds},
+			} {
+				if math.Abs(*p.got-*p.want) > 1e-9 {
+					t.Errorf("Apply() price = %v, want %v", *p.got, *p.want)
+				}
+				*p.got = *p.want
+			}
+			if got != *tt.want {
+				t.Errorf("Apply() = %+v\nwant %+v", got, *tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/batch"
+	"github.com/matthewhu/sportarbitrage/internal/bus"
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/metrics"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+)
+
+// Recorder copies every processed odds tick into odds_history, in batches,
+// and keeps the table's daily partitions: creating them ahead of time and
+// dropping them once past the retention.
+//
+// Like the history writer, ticks are acked once their batch is copied, so
+// those still buffered when the process dies are delivered again. A late
+// tick still within the retention gets its day's partition created as it
+// arrives; ticks older than that, or from beyond the partitions created
+// ahead, are counted and skipped, as COPY would fail the whole batch on
+// them.
+type Recorder struct {
+	cfg    *config.Config
+	bus    bus.Bus
+	repo   *storage.OddsHistoryRepository
+	batch  *batch.Writer[tick]
+	logger *slog.Logger
+
+	// Days before the window whose partitions were created for late ticks
+	lateDays   map[time.Time]bool
+	lateDaysMu sync.Mutex
+}
+
+// tick is a buffered message and the odds it carried, nil if it is only
+// to be acked in turn with the rest
+type tick struct {
+	odds *models.OddsUpdate
+	msg  bus.Message
+}
+
+// NewRecorder creates a recorder reading ticks from b into repo
+func NewRecorder(cfg *config.Config, b bus.Bus, repo *storage.OddsHistoryRepository) *Recorder {
+	opts := batch.Options{
+		Size:          cfg.Recorder.BatchSize,
+		FlushInterval: cfg.Recorder.FlushInterval.Duration,
+		BufferSize:    cfg.Recorder.BufferSize,
+		RetryInterval: cfg.Recorder.RetryInterval.Duration,
+		DrainTimeout:  cfg.HTTP.ShutdownTimeout.Duration,
+	}
+
+	r := &Recorder{
+		cfg:      cfg,
+		bus:      b,
+		repo:     repo,
+		logger:   slog.With("component", "recorder"),
+		lateDays: make(map[time.Time]bool),
+	}
+	r.batch = batch.NewWriter("odds_history", opts, r.save)
+	return r
+}
+
+// Run consumes ticks until ctx is cancelled, then writes what is buffered,
+// giving up after the shutdown timeout. Partitions are maintained first,
+// so the first batch has somewhere to go.
+func (r *Recorder) Run(ctx context.Context) error {
+	r.logger.Info("Starting odds recorder", "batch_size", r.cfg.Recorder.BatchSize,
+		"retention_days", r.cfg.Recorder.RetentionDays)
+
+	if err := r.maintain(ctx); err != nil {
+		return err
+	}
+	go r.maintainLoop(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.batch.Run(ctx)
+	}()
+
+	err := r.bus.Subscribe(ctx, r.cfg.Kafka.Topics.OddsProcessed, r.cfg.Kafka.Groups.Recorder, r.handle)
+	if err != nil {
+		r.logger.Error("Odds subscription ended", "error", err)
+	}
+
+	// The subscription has returned, so nothing is added any more
+	r.batch.Close()
+	<-done
+	return nil
+}
+
+func (r *Recorder) handle(ctx context.Context, msg bus.Message) {
+	t := tick{msg: msg}
+
+	var odds models.OddsUpdate
+	if err := msg.Decode(&odds); err != nil {
+		if bus.PublishDeadLetter(ctx, r.bus, "recorder", msg, fmt.Errorf("failed to parse odds: %w", err)) != nil {
+			return
+		}
+	} else if err := odds.Validate(); err != nil {
+		if bus.PublishDeadLetter(ctx, r.bus, "recorder", msg, fmt.Errorf("invalid odds: %w", err)) != nil {
+			return
+		}
+	} else {
+		ok, err := r.partitioned(ctx, odds.Timestamp)
+		if err != nil {
+			// Left unacked, the tick is delivered again
+			r.logger.ErrorContext(ctx, "Error creating partition for late tick", append(msg.LogAttrs(),
+				"timestamp", odds.Timestamp, "error", err)...)
+			return
+		}
+		if ok {
+			t.odds = &odds
+		}
+	}
+
+	// Waits while the buffer is full
+	if !r.batch.Add(ctx, t) {
+		return
+	}
+
+	if err := r.bus.Defer(ctx, msg); err != nil {
+		r.logger.ErrorContext(ctx, "Error deferring ack", append(msg.LogAttrs(), "error", err)...)
+	}
+}
+
+// partitioned reports whether a tick at ts has a partition to go to,
+// creating it for a late tick still within the retention. Ticks it
+// reports false for are counted and logged.
+func (r *Recorder) partitioned(ctx context.Context, ts time.Time) (bool, error) {
+	now := time.Now()
+	from, to := r.window(now)
+	if !ts.Before(from) && ts.Before(to) {
+		return true, nil
+	}
+
+	reason := "ahead"
+	if ts.Before(from) {
+		// The cutoff day's partition is dropped at the next midnight, so
+		// only later days are created
+		day := ts.UTC().Truncate(24 * time.Hour)
+		if day.After(r.cutoff(now)) {
+			r.lateDaysMu.Lock()
+			defer r.lateDaysMu.Unlock()
+			if !r.lateDays[day] {
+				if err := r.repo.EnsurePartitions(ctx, day, day); err != nil {
+					return false, err
+				}
+				r.lateDays[day] = true
+				r.logger.InfoContext(ctx, "Created partition for late ticks", "day", day.Format(time.DateOnly))
+			}
+			return true, nil
+		}
+		reason = "past_retention"
+	}
+
+	metrics.RowsSkipped.WithLabelValues("odds_history", reason).Inc()
+	r.logger.WarnContext(ctx, "Skipping tick without a partition", "reason", reason, "timestamp", ts,
+		"window_from", from, "window_to", to)
+	return false, nil
+}
+
+// save copies a batch and then acks its messages. A failed ack is only
+// logged, as the ticks are written.
+func (r *Recorder) save(ctx context.Context, ticks []tick) error {
+	odds := make([]models.OddsUpdate, 0, len(ticks))
+	msgs := make([]bus.Message, len(ticks))
+	for i, t := range ticks {
+		if t.odds != nil {
+			odds = append(odds, *t.odds)
+		}
+		msgs[i] = t.msg
+	}
+
+	if len(odds) > 0 {
+		if err := r.repo.CopyTicks(ctx, odds); err != nil {
+			return err
+		}
+	}
+	if err := bus.AckLatest(ctx, r.bus, msgs); err != nil {
+		r.logger.Warn("Error acking copied ticks, they will be delivered again", "rows", len(odds), "error", err)
+	}
+	return nil
+}
+
+// window returns the range of tick times guaranteed a partition: from the
+// start of yesterday, for ticks delayed over midnight, to the end of the
+// last day created ahead
+func (r *Recorder) window(now time.Time) (from, to time.Time) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	return today.AddDate(0, 0, -1), today.AddDate(0, 0, r.cfg.Recorder.PartitionsAhead+1)
+}
+
+// maintain creates the partitions of the window and drops those past the
+// retention
+func (r *Recorder) maintain(ctx context.Context) error {
+	now := time.Now()
+	from, to := r.window(now)
+	if err := r.repo.EnsurePartitions(ctx, from, to.Add(-time.Nanosecond)); err != nil {
+		return err
+	}
+
+	cutoff := r.cutoff(now)
+	dropped, err := r.repo.DropPartitionsBefore(ctx, cutoff)
+	if len(dropped) > 0 {
+		r.logger.Info("Dropped expired partitions", "partitions", dropped)
+	}
+
+	r.lateDaysMu.Lock()
+	for day := range r.lateDays {
+		if day.Before(cutoff) {
+			delete(r.lateDays, day)
+		}
+	}
+	r.lateDaysMu.Unlock()
+	return err
+}
+
+// cutoff returns the first day kept by the retention
+func (r *Recorder) cutoff(now time.Time) time.Time {
+	return now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -r.cfg.Recorder.RetentionDays)
+}
+
+func (r *Recorder) maintainLoop(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Recorder.MaintenanceInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Partitions are created days ahead, so a failure here is retried
+			// well before ticks run out of room
+			if err := r.maintain(ctx); err != nil {
+				r.logger.Error("Error maintaining partitions", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package schema
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// Subjects with a registered schema
+const (
+	SubjectOddsUpdate           = "odds-update"
+	SubjectArbitrageOpportunity = "arbitrage-opportunity"
+)
+
+//go:embed schemas
+var embedded embed.FS
+
+// Registry is a file-based stand-in for a schema registry. Schemas live at
+// <dir>/<subject>/v<N>.avsc, and every version of a subject must be able to
+// read data written with any earlier version.
+type Registry struct {
+	subjects map[string][]avro.Schema  // versions in order, v1 first
+	compat   *avro.SchemaCompatibility // resolves older versions against the latest
+
+	mu       sync.Mutex
+	resolved map[string]avro.Schema // latest reading older versions, by subject/version
+}
+
+// Embedded returns the registry compiled into the binary
+func Embedded() (*Registry, error) {
+	sub, err := fs.Sub(embedded, "schemas")
+	if err != nil {
+		return nil, err
+	}
+	return load(sub)
+}
+
+// NewFileRegistry loads the schemas under dir
+func NewFileRegistry(dir string) (*Registry, error) {
+	return load(os.DirFS(dir))
+}
+
+func load(fsys fs.FS) (*Registry, error) {
+	r := &Registry{
+		subjects: make(map[string][]avro.Schema),
+		compat:   avro.NewSchemaCompatibility(),
+		resolved: make(map[string]avro.Schema),
+	}
+
+	dirs, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema directory: %w", err)
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		subject := dir.Name()
+
+		versions, err := readVersions(fsys, subject)
+		if err != nil {
+			return nil, err
+		}
+		r.subjects[subject] = versions
+	}
+
+	if err := r.Check(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// readVersions parses v1.avsc, v2.avsc, ... for subject. Versions must be
+// numbered from 1 without gaps.
+func readVersions(fsys fs.FS, subject string) ([]avro.Schema, error) {
+	files, err := fs.ReadDir(fsys, subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schemas for %s: %w", subject, err)
+	}
+
+	byVersion := make(map[int]string)
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasPrefix(name, "v") || !strings.HasSuffix(name, ".avsc") {
+			continue
+		}
+		version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "v"), ".avsc"))
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("bad schema file name %s/%s", subject, name)
+		}
+		byVersion[version] = name
+	}
+
+	numbers := make([]int, 0, len(byVersion))
+	for v := range byVersion {
+		numbers = append(numbers, v)
+	}
+	sort.Ints(numbers)
+
+	var versions []avro.Schema
+	for i, v := range numbers {
+		if v != i+1 {
+			return nil, fmt.Errorf("schemas for %s skip from v%d to v%d", subject, i, v)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(subject, byVersion[v]))
+		if err != nil {
+			return nil, err
+		}
+		s, err := avro.Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s v%d: %w", subject, v, err)
+		}
+		versions = append(versions, s)
+	}
+
+	return versions, nil
+}
+
+// Check verifies every subject's versions are backward compatible with
+// all the versions before them
+func (r *Registry) Check() error {
+	for subject, versions := range r.subjects {
+		for i := 1; i < len(versions); i++ {
+			if err := r.compatibleWith(subject, versions[i], i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CheckCandidate reports whether s could be registered as the next version
+// of subject
+func (r *Registry) CheckCandidate(subject string, s avro.Schema) error {
+	return r.compatibleWith(subject, s, len(r.subjects[subject]))
+}
+
+// compatibleWith checks reader can read data from the first n versions.
+// A SchemaCompatibility caches results by canonical form, which leaves out
+// defaults, so every check gets a fresh one; otherwise a candidate missing
+// a default would pass for having the same form as one that had it.
+func (r *Registry) compatibleWith(subject string, reader avro.Schema, n int) error {
+	compat := avro.NewSchemaCompatibility()
+	for v := 0; v < n; v++ {
+		if err := compat.Compatible(reader, r.subjects[subject][v]); err != nil {
+			return fmt.Errorf("%s v%d cannot read v%d: %w", subject, n+1, v+1, err)
+		}
+	}
+	return nil
+}
+
+// Latest returns the newest version of subject
+func (r *Registry) Latest(subject string) (int, avro.Schema, error) {
+	versions := r.subjects[subject]
+	if len(versions) == 0 {
+		return 0, nil, fmt.Errorf("no schema registered for %s", subject)
+	}
+	return len(versions), versions[len(versions)-1], nil
+}
+
+// Get returns a specific version of subject
+func (r *Registry) Get(subject string, version int) (avro.Schema, error) {
+	versions := r.subjects[subject]
+	if version < 1 || version > len(versions) {
+		return nil, fmt.Errorf("no schema %s v%d", subject, version)
+	}
+	return versions[version-1], nil
+}
+
+// Reader returns the schema to decode data written with version of
+// subject into the latest version's shape
+func (r *Registry) Reader(subject string, version int) (avro.Schema, error) {
+	latestVersion, latest, err := r.Latest(subject)
+	if err != nil {
+		return nil, err
+	}
+	if version == latestVersion {
+		return latest, nil
+	}
+
+	key := subject + "/" + strconv.Itoa(version)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, ok := r.resolved[key]; ok {
+		return s, nil
+	}
+
+	writer, err := r.Get(subject, version)
+	if err != nil {
+		return nil, err
+	}
+	s, err := r.compat.Resolve(latest, writer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s v%d: %w", subject, version, err)
+	}
+	r.resolved[key] = s
+
+	return s, nil
+}
+
+// Subjects lists the registered subjects
+func (r *Registry) Subjects() []string {
+	subjects := make([]string, 0, len(r.subjects))
+	for s := range r.subjects {
+		subjects = append(subjects, s)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// Versions returns how many versions subject has
+func (r *Registry) Versions(subject string) int {
+	return len(r.subjects[subject])
+}
+
+// SubjectFor returns the subject for a value's type, or "" if it has none
+func SubjectFor(v interface{}) string {
+	switch v.(type) {
+	case models.OddsUpdate, *models.OddsUpdate:
+		return SubjectOddsUpdate
+	case models.ArbitrageOpportunity, *models.ArbitrageOpportunity:
+		return SubjectArbitrageOpportunity
+	}
+	return ""
+}
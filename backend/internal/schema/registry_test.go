@@ -0,0 +1,276 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+func embeddedRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r, err := Embedded()
+	if err != nil {
+		t.Fatalf("Embedded(): %v", err)
+	}
+	return r
+}
+
+func TestEmbeddedVersions(t *testing.T) {
+	r := embeddedRegistry(t)
+
+	want := []string{SubjectArbitrageOpportunity, SubjectOddsUpdate}
+	if got := r.Subjects(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Subjects() = %v, want %v", got, want)
+	}
+	for _, subject := range want {
+		if n := r.Versions(subject); n != 2 {
+			t.Errorf("Versions(%s) = %d, want 2", subject, n)
+		}
+	}
+}
+
+// TestReadOlderVersions writes a value with each version of its schema and
+// reads it back with the latest, which fills in the fields added since
+func TestReadOlderVersions(t *testing.T) {
+	r := embeddedRegistry(t)
+	at := time.Date(2026, 3, 1, 19, 0, 0, 123456000, time.UTC)
+	epoch := time.UnixMicro(0).UTC()
+
+	odds := models.OddsUpdate{
+		ID:         "odds-1",
+		EventID:    "lakers-vs-celtics",
+		Sport:      "NBA",
+		HomeTeam:   "Lakers",
+		AwayTeam:   "Celtics",
+		Bookmaker:  "booka",
+		HomeOdds:   2.1,
+		AwayOdds:   1.8,
+		Timestamp:  at,
+		MarketType: "moneyline",
+		OddsFormat: "american",
+	}
+	arb := models.ArbitrageOpportunity{
+		ID:            "arb-1",
+		EventID:       "lakers-vs-celtics",
+		Sport:         "NBA",
+		BookmakerHome: "booka",
+		BookmakerAway: "bookb",
+		HomeOdds:      2.1,
+		AwayOdds:      2.1,
+		ProfitPercent: 5,
+		CreatedAt:     at,
+		ExpiresAt:     at.Add(time.Minute),
+		Status:        models.OpportunityActive,
+		Confidence:    0.9,
+		MarketType:    "spread",
+		Event:         "closed",
+		UpdatedAt:     at.Add(time.Second),
+		CloseReason:   "expired",
+		Lifetime:      1,
+	}
+
+	tests := []struct {
+		name    string
+		subject string
+		version int
+		value   interface{}
+		want    interface{}
+	}{
+		{
+			name:    "odds v1, no format",
+			subject: SubjectOddsUpdate,
+			version: 1,
+			value:   odds,
+			want: func() models.OddsUpdate {
+				o := odds
+				o.OddsFormat = ""
+				return o
+			}(),
+		},
+		{name: "odds v2", subject: SubjectOddsUpdate, version: 2, value: odds, want: odds},
+		{
+			name:    "arbitrage v1, defaults for the lifecycle",
+			subject: SubjectArbitrageOpportunity,
+			version: 1,
+			value:   arb,
+			want: func() models.ArbitrageOpportunity {
+				a := arb
+				a.MarketType = "moneyline"
+				a.Event = "opened"
+				a.UpdatedAt = epoch
+				a.CloseReason = ""
+				a.Lifetime = 0
+				return a
+			}(),
+		},
+		{name: "arbitrage v2", subject: SubjectArbitrageOpportunity, version: 2, value: arb, want: arb},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer, err := r.Get(tt.subject, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := avro.Marshal(writer, tt.value)
+			if err != nil {
+				t.Fatalf("Marshal(): %v", err)
+			}
+
+			reader, err := r.Reader(tt.subject, tt.version)
+			if err != nil {
+				t.Fatalf("Reader(): %v", err)
+			}
+			got := reflect.New(reflect.TypeOf(tt.want))
+			if err := avro.Unmarshal(reader, data, got.Interface()); err != nil {
+				t.Fatalf("Unmarshal(): %v", err)
+			}
+			if !reflect.DeepEqual(got.Elem().Interface(), tt.want) {
+				t.Errorf("read %+v\nwant %+v", got.Elem().Interface(), tt.want)
+			}
+		})
+	}
+}
+
+// oddsV3 returns the odds-update v2 schema with extra fields appended
+func oddsV3(t *testing.T, fields ...string) avro.Schema {
+	t.Helper()
+	all := append([]string{
+		`{"name": "id", "type": "string"}`,
+		`{"name": "event_id", "type": "string"}`,
+		`{"name": "sport", "type": "string"}`,
+		`{"name": "home_team", "type": "string"}`,
+		`{"name": "away_team", "type": "string"}`,
+		`{"name": "bookmaker", "type": "string"}`,
+		`{"name": "home_odds", "type": "double"}`,
+		`{"name": "away_odds", "type": "double"}`,
+		`{"name": "draw_odds", "type": "double", "default": 0}`,
+		`{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-micros"}}`,
+		`{"name": "market_type", "type": "string"}`,
+		`{"name": "odds_format", "type": "string", "default": ""}`,
+	}, fields...)
+	return parse(t, all...)
+}
+
+func parse(t *testing.T, fields ...string) avro.Schema {
+	t.Helper()
+	s, err := avro.Parse(`{"type": "record", "name": "OddsUpdate", "namespace": "sportarbitrage", "fields": [` +
+		strings.Join(fields, ", ") + `]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCheckCandidate(t *testing.T) {
+	r := embeddedRegistry(t)
+
+	tests := []struct {
+		name      string
+		candidate avro.Schema
+		wantErr   bool
+	}{
+		{name: "unchanged", candidate: oddsV3(t)},
+		{name: "field added with a default", candidate: oddsV3(t, `{"name": "line", "type": "double", "default": 0}`)},
+		{name: "field added without a default", candidate: oddsV3(t, `{"name": "line", "type": "double"}`), wantErr: true},
+		{
+			name: "field removed",
+			candidate: parse(t,
+				`{"name": "id", "type": "string"}`,
+				`{"name": "event_id", "type": "string"}`,
+			),
+		},
+		{
+			name: "field type changed",
+			candidate: parse(t,
+				`{"name": "id", "type": "string"}`,
+				`{"name": "home_odds", "type": "string"}`,
+			),
+			wantErr: true,
+		},
+		{
+			name: "int widened to long",
+			candidate: parse(t,
+				`{"name": "id", "type": "string"}`,
+				`{"name": "home_odds", "type": "double"}`,
+				`{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-micros"}}`,
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.CheckCandidate(SubjectOddsUpdate, tt.candidate)
+			if tt.wantErr && err == nil {
+				t.Error("CheckCandidate() accepted an incompatible schema")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("CheckCandidate(): %v", err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	const v1 = `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "string"}]}`
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:  "compatible versions",
+			files: map[string]string{"r/v1.avsc": v1, "r/v2.avsc": `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "string"}, {"name": "b", "type": "long", "default": 0}]}`},
+		},
+		{
+			name:  "other files are ignored",
+			files: map[string]string{"r/v1.avsc": v1, "r/README.md": "notes", "top.txt": "notes"},
+		},
+		{
+			name:    "incompatible version",
+			files:   map[string]string{"r/v1.avsc": v1, "r/v2.avsc": `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "string"}, {"name": "b", "type": "long"}]}`},
+			wantErr: "r v2 cannot read v1",
+		},
+		{
+			name:    "gap in versions",
+			files:   map[string]string{"r/v1.avsc": v1, "r/v3.avsc": v1},
+			wantErr: "skip from v1 to v3",
+		},
+		{
+			name:    "bad file name",
+			files:   map[string]string{"r/v1.avsc": v1, "r/vlatest.avsc": v1},
+			wantErr: "bad schema file name",
+		},
+		{
+			name:    "unparseable schema",
+			files:   map[string]string{"r/v1.avsc": `{"type": "record"`},
+			wantErr: "failed to parse r v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for name, data := range tt.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(data)}
+			}
+
+			_, err := load(fsys)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("load(): %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// SignalContext returns a root context cancelled on SIGINT or SIGTERM
+func SignalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// DrainContext returns a context for the work still in flight when ctx is
+// cancelled. It outlives ctx by timeout, so every step of a shutdown that
+// runs on it shares one deadline counted from the signal.
+func DrainContext(ctx context.Context, timeout time.Duration) context.Context {
+	drain, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	context.AfterFunc(ctx, func() {
+		time.AfterFunc(timeout, cancel)
+	})
+	return drain
+}
+
+// Shutdown runs cleanup and waits for it, giving up once drain, from
+// DrainContext, is cancelled. The context handed to cleanup is drain.
+// Cancel the root context first so the deadline is running even when
+// the service stopped on its own.
+func Shutdown(drain context.Context, cleanup func(ctx context.Context)) error {
+	slog.Info("Shutting down")
+
+	done := make(chan struct{})
+	go func() {
+		cleanup(drain)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("Shutdown complete")
+		return nil
+	case <-drain.Done():
+		return errors.New("shutdown did not finish within the shutdown timeout")
+	}
+}
@@ -0,0 +1,218 @@
+package startup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"github.com/matthewhu/sportarbitrage/internal/kafka"
+	"github.com/redis/go-redis/v9"
+)
+
+// Backoff bounds how long we keep retrying a dependency
+type Backoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	MaxAttempts int
+}
+
+// BackoffFrom converts the startup settings of the config
+func BackoffFrom(c config.StartupConfig) Backoff {
+	return Backoff{
+		Initial:     c.InitialBackoff.Duration,
+		Max:         c.MaxBackoff.Duration,
+		MaxAttempts: c.MaxAttempts,
+	}
+}
+
+// Check probes a single dependency
+type Check struct {
+	Name  string
+	Probe func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a check, exposed on /ready
+type CheckResult struct {
+	Name     string `json:"name"`
+	Ready    bool   `json:"ready"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Readiness collects check results for a service
+type Readiness struct {
+	service string
+	mu      sync.RWMutex
+	ready   bool
+	checks  []CheckResult
+}
+
+// NewReadiness creates an empty, not-yet-ready report for a service
+func NewReadiness(service string) *Readiness {
+	return &Readiness{service: service}
+}
+
+// Report is the JSON body served on /ready
+type Report struct {
+	Service string        `json:"service"`
+	Ready   bool          `json:"ready"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+// Report returns a snapshot of the current readiness
+func (r *Readiness) Report() Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return Report{
+		Service: r.service,
+		Ready:   r.ready,
+		Checks:  append([]CheckResult(nil), r.checks...),
+	}
+}
+
+// Ready reports whether every dependency came up
+func (r *Readiness) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ready
+}
+
+// WaitFor runs each check with exponential backoff until it passes or its
+// attempts run out. It returns an error naming the first dependency that
+// never came up.
+func (r *Readiness) WaitFor(ctx context.Context, backoff Backoff, checks ...Check) error {
+	for _, check := range checks {
+		result := run(ctx, backoff, check)
+
+		r.mu.Lock()
+		r.checks = append(r.checks, result)
+		r.mu.Unlock()
+
+		if !result.Ready {
+			return fmt.Errorf("%s not ready after %d attempts: %s", check.Name, result.Attempts, result.Error)
+		}
+		slog.Info("Dependency is ready", "dependency", check.Name, "attempts", result.Attempts, "duration", result.Duration)
+	}
+
+	r.mu.Lock()
+	r.ready = true
+	r.mu.Unlock()
+
+	return nil
+}
+
+func run(ctx context.Context, backoff Backoff, check Check) CheckResult {
+	start := time.Now()
+	delay := backoff.Initial
+	result := CheckResult{Name: check.Name}
+
+	for result.Attempts < backoff.MaxAttempts {
+		result.Attempts++
+
+		probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := check.Probe(probeCtx)
+		cancel()
+
+		if err == nil {
+			result.Ready = true
+			result.Error = ""
+			break
+		}
+		result.Error = err.Error()
+
+		if result.Attempts == backoff.MaxAttempts {
+			break
+		}
+
+		slog.Warn("Waiting for dependency", "dependency", check.Name,
+			"attempt", result.Attempts, "max_attempts", backoff.MaxAttempts, "error", err)
+		select {
+		case <-ctx.Done():
+			result.Error = ctx.Err().Error()
+			result.Duration = time.Since(start).Round(time.Millisecond).String()
+			return result
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > backoff.Max {
+			delay = backoff.Max
+		}
+	}
+
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	return result
+}
+
+// Kafka checks the brokers answer metadata requests and that the topics
+// exist. It only reads metadata; the topics command creates them.
+func Kafka(brokers []string, topics ...string) Check {
+	return Check{
+		Name: "kafka",
+		Probe: func(ctx context.Context) error {
+			missing, err := kafka.MissingTopics(ctx, brokers, topics)
+			if err != nil {
+				return err
+			}
+			if len(missing) > 0 {
+				return fmt.Errorf("missing topics %v", missing)
+			}
+			return nil
+		},
+	}
+}
+
+// Redis checks the server answers PING
+func Redis(client *redis.Client) Check {
+	return Check{
+		Name: "redis",
+		Probe: func(ctx context.Context) error {
+			return client.Ping(ctx).Err()
+		},
+	}
+}
+
+// Postgres checks the database accepts connections
+func Postgres(db *sql.DB) Check {
+	return Check{
+		Name: "postgres",
+		Probe: func(ctx context.Context) error {
+			return db.PingContext(ctx)
+		},
+	}
+}
+
+// Handler serves the readiness report, 503 until every check has passed
+func (r *Readiness) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Report()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Register adds /ready to a mux that also serves other admin endpoints
+func (r *Readiness) Register(mux *http.ServeMux) {
+	mux.Handle("/ready", r.Handler())
+}
+
+// ListenAndServe runs an admin HTTP server in the background
+func ListenAndServe(addr string, mux *http.ServeMux) {
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Admin server stopped", "addr", addr, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// EventRepository persists the event catalogue to the events table
+type EventRepository struct {
+	db *sql.DB
+}
+
+// NewEventRepository creates a repository on top of an open connection pool
+func NewEventRepository(db *sql.DB) *EventRepository {
+	return &EventRepository{db: db}
+}
+
+// UpsertEvent inserts an event or refreshes its schedule and status
+func (r *EventRepository) UpsertEvent(ctx context.Context, ev *models.Event) error {
+	var end sql.NullTime
+	if !ev.EndTime.IsZero() {
+		end = sql.NullTime{Time: ev.EndTime.UTC(), Valid: true}
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO events (id, sport, league, home_team, away_team, start_time, end_time, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			sport = EXCLUDED.sport,
+			league = EXCLUDED.league,
+			home_team = EXCLUDED.home_team,
+			away_team = EXCLUDED.away_team,
+			start_time = EXCLUDED.start_time,
+			end_time = EXCLUDED.end_time,
+			status = EXCLUDED.status`,
+		ev.ID, ev.Sport, ev.League, ev.HomeTeam, ev.AwayTeam, ev.StartTime.UTC(), end, ev.Status)
+	if err != nil {
+		return fmt.Errorf("failed to upsert event %s: %w", ev.ID, err)
+	}
+	return nil
+}
+
+// ListEvents returns every event in the catalogue
+func (r *EventRepository) ListEvents(ctx context.Context) ([]models.Event, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, sport, COALESCE(league, ''), home_team, away_team, start_time, end_time, status
+		FROM events`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		var ev models.Event
+		var start, end sql.NullTime
+		if err := rows.Scan(&ev.ID, &ev.Sport, &ev.League, &ev.HomeTeam, &ev.AwayTeam, &start, &end, &ev.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		if start.Valid {
+			ev.StartTime = start.Time.UTC()
+		}
+		if end.Valid {
+			ev.EndTime = end.Time.UTC()
+		}
+		events = append(events, ev)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// historyColumns are written for every opportunity, in this order
+var historyColumns = []string{
+	"id", "event_id", "sport", "market_type", "home_team", "away_team",
+	"bookmaker_home", "bookmaker_away", "home_odds", "away_odds",
+	"profit_percent", "home_stake", "away_stake", "total_stake", "expected_return",
+	"live", "confidence", "status", "created_at", "updated_at", "expires_at",
+	"closed_at", "close_reason", "lifetime_seconds",
+}
+
+// HistoryRepository records opportunities in the arbitrage_history table,
+// one row per opportunity holding its latest state. As an OpportunityStore
+// it serves the open rows.
+type HistoryRepository struct {
+	db *sql.DB
+}
+
+// NewHistoryRepository creates a repository on top of an open connection pool
+func NewHistoryRepository(db *sql.DB) *HistoryRepository {
+	return &HistoryRepository{db: db}
+}
+
+// SaveBatch upserts opportunities in one statement. A state older than
+// the one stored is ignored, so replayed or reordered messages are harmless.
+func (r *HistoryRepository) SaveBatch(ctx context.Context, opportunities []models.ArbitrageOpportunity) error {
+	latest := latestStates(opportunities)
+	if len(latest) == 0 {
+		return nil
+	}
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO arbitrage_history (")
+	query.WriteString(strings.Join(historyColumns, ", "))
+	query.WriteString(") VALUES ")
+
+	args := make([]interface{}, 0, len(latest)*len(historyColumns))
+	for i, arb := range latest {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j := range historyColumns {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", len(args)+j+1)
+		}
+		query.WriteString(")")
+
+		// Close columns stay NULL while the opportunity is open
+		var closedAt sql.NullTime
+		var closeReason sql.NullString
+		var lifetime sql.NullFloat64
+		if arb.Event == models.OpportunityClosed {
+			closedAt = sql.NullTime{Time: arb.UpdatedAt.UTC(), Valid: true}
+			closeReason = sql.NullString{String: arb.CloseReason, Valid: true}
+			lifetime = sql.NullFloat64{Float64: arb.Lifetime, Valid: true}
+		}
+		args = append(args,
+			arb.ID, arb.EventID, arb.Sport, arb.MarketType, arb.HomeTeam, arb.AwayTeam,
+			arb.BookmakerHome, arb.BookmakerAway, arb.HomeOdds, arb.AwayOdds,
+			arb.ProfitPercent, arb.HomeStake, arb.AwayStake, arb.TotalStake, arb.ExpectedReturn,
+			arb.Live, arb.Confidence, arb.Status, arb.CreatedAt.UTC(), arb.UpdatedAt.UTC(), arb.ExpiresAt.UTC(),
+			closedAt, closeReason, lifetime,
+		)
+	}
+
+	// A reopened opportunity overwrites its closed row, clearing closed_at
+	query.WriteString(" ON CONFLICT (id) DO UPDATE SET ")
+	for i, column := range historyColumns[1:] {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		fmt.Fprintf(&query, "%s = EXCLUDED.%s", column, column)
+	}
+	query.WriteString(" WHERE arbitrage_history.updated_at <= EXCLUDED.updated_at")
+
+	if _, err := r.db.ExecContext(ctx, query.String(), args...); err != nil {
+		return fmt.Errorf("failed to save %d opportunities: %w", len(latest), err)
+	}
+	return nil
+}
+
+// latestStates keeps each opportunity's most recent state, as one
+// statement can't update a row twice
+func latestStates(opportunities []models.ArbitrageOpportunity) []models.ArbitrageOpportunity {
+	index := make(map[string]int, len(opportunities))
+	latest := make([]models.ArbitrageOpportunity, 0, len(opportunities))
+	for _, arb := range opportunities {
+		i, ok := index[arb.ID]
+		if !ok {
+			index[arb.ID] = len(latest)
+			latest = append(latest, arb)
+			continue
+		}
+		if !arb.UpdatedAt.Before(latest[i].UpdatedAt) {
+			latest[i] = arb
+		}
+	}
+	return latest
+}
+
+// SaveOpportunity implements OpportunityStore, saving the one state
+func (r *HistoryRepository) SaveOpportunity(ctx context.Context, arb *models.ArbitrageOpportunity) error {
+	return r.SaveBatch(ctx, []models.ArbitrageOpportunity{*arb})
+}
+
+// RemoveOpportunity implements OpportunityStore by closing the row now.
+// The reason and lifetime are left to the closed state's own SaveBatch.
+func (r *HistoryRepository) RemoveOpportunity(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE arbitrage_history SET closed_at = $2 WHERE id = $1 AND closed_at IS NULL",
+		id, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to close opportunity %s: %w", id, err)
+	}
+	return nil
+}
+
+// ActiveOpportunities implements OpportunityStore from the rows not yet
+// closed or expired
+func (r *HistoryRepository) ActiveOpportunities(ctx context.Context, page Page) ([]models.ArbitrageOpportunity, int, error) {
+	now := time.Now().UTC()
+
+	var total int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM arbitrage_history WHERE closed_at IS NULL AND expires_at > $1", now).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count open opportunities: %w", err)
+	}
+
+	// Everything up to expires_at; the close columns are NULL. LIMIT ALL
+	// is what a NULL limit means, and a NULL position the beginning.
+	var limit sql.NullInt64
+	if page.Limit > 0 {
+		limit = sql.NullInt64{Int64: int64(page.Limit), Valid: true}
+	}
+	var afterExpiry sql.NullTime
+	var afterID sql.NullString
+	if page.After != nil {
+		afterExpiry = sql.NullTime{Time: page.After.ExpiresAt.UTC().Truncate(time.Millisecond), Valid: true}
+		afterID = sql.NullString{String: page.After.ID, Valid: true}
+	}
+	columns := historyColumns[:len(historyColumns)-3]
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM arbitrage_history
+		WHERE closed_at IS NULL AND expires_at > $1
+			AND ($4::timestamp IS NULL OR (date_trunc('milliseconds', expires_at), id) > ($4, $5::uuid))
+		ORDER BY date_trunc('milliseconds', expires_at), id
+		OFFSET $2 LIMIT $3`,
+		strings.Join(columns, ", ")), now, max(page.Offset, 0), limit, afterExpiry, afterID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list open opportunities: %w", err)
+	}
+	defer rows.Close()
+
+	var opportunities []models.ArbitrageOpportunity
+	for rows.Next() {
+		var arb models.ArbitrageOpportunity
+		var status sql.NullString
+		err := rows.Scan(
+			&arb.ID, &arb.EventID, &arb.Sport, &arb.MarketType, &arb.HomeTeam, &arb.AwayTeam,
+			&arb.BookmakerHome, &arb.BookmakerAway, &arb.HomeOdds, &arb.AwayOdds,
+			&arb.ProfitPercent, &arb.HomeStake, &arb.AwayStake, &arb.TotalStake, &arb.ExpectedReturn,
+			&arb.Live, &arb.Confidence, &status, &arb.CreatedAt, &arb.UpdatedAt, &arb.ExpiresAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan opportunity: %w", err)
+		}
+		arb.Status = status.String
+		arb.CreatedAt, arb.UpdatedAt, arb.ExpiresAt = arb.CreatedAt.UTC(), arb.UpdatedAt.UTC(), arb.ExpiresAt.UTC()
+		opportunities = append(opportunities, arb)
+	}
+
+	return opportunities, total, rows.Err()
+}
+
+// PruneOpportunities implements OpportunityStore. Expired rows are left
+// open, as history, and reads already skip them.
+func (r *HistoryRepository) PruneOpportunities(ctx context.Context) (int, error) {
+	return 0, nil
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// LatestOddsRepository is an OddsStore on the latest_odds table, a row per
+// event and book. Rows not saved again within the TTL are skipped on read;
+// an event's are deleted when one of its books next quotes.
+type LatestOddsRepository struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// NewLatestOddsRepository creates a repository on top of an open connection pool
+func NewLatestOddsRepository(db *sql.DB, ttl time.Duration) *LatestOddsRepository {
+	return &LatestOddsRepository{db: db, ttl: ttl}
+}
+
+// SaveOdds implements OddsStore. The event's other stale quotes are
+// deleted in the same statement.
+func (r *LatestOddsRepository) SaveOdds(ctx context.Context, odds *models.OddsUpdate) error {
+	data, err := json.Marshal(odds)
+	if err != nil {
+		return fmt.Errorf("failed to marshal odds: %w", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = r.db.ExecContext(ctx, `
+		WITH pruned AS (
+			DELETE FROM latest_odds WHERE event_id = $1 AND bookmaker <> $2 AND saved_at <= $5
+		)
+		INSERT INTO latest_odds (event_id, bookmaker, data, saved_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (event_id, bookmaker) DO UPDATE SET
+			data = EXCLUDED.data,
+			saved_at = EXCLUDED.saved_at`,
+		odds.EventID, odds.Bookmaker, data, now, now.Add(-r.ttl))
+	if err != nil {
+		return fmt.Errorf("failed to save odds: %w", err)
+	}
+	return nil
+}
+
+// EventOdds implements OddsStore
+func (r *LatestOddsRepository) EventOdds(ctx context.Context, eventID string) ([]models.OddsUpdate, error) {
+	odds, err := r.EventsOdds(ctx, []string{eventID})
+	if err != nil {
+		return nil, err
+	}
+	return odds[eventID], nil
+}
+
+// EventsOdds implements OddsStore in one query
+func (r *LatestOddsRepository) EventsOdds(ctx context.Context, eventIDs []string) (map[string][]models.OddsUpdate, error) {
+	odds := make(map[string][]models.OddsUpdate, len(eventIDs))
+	if len(eventIDs) == 0 {
+		return odds, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT event_id, bookmaker, data FROM latest_odds
+		WHERE event_id = ANY($1) AND saved_at > $2`,
+		pq.Array(eventIDs), time.Now().UTC().Add(-r.ttl))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read odds: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventID, bookmaker string
+		var data []byte
+		if err := rows.Scan(&eventID, &bookmaker, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan odds: %w", err)
+		}
+		var odd models.OddsUpdate
+		if err := json.Unmarshal(data, &odd); err != nil {
+			continue
+		}
+		odds[eventID] = append(odds[eventID], odd)
+	}
+	return odds, rows.Err()
+}
+
+// ScanOdds implements OddsStore, passing fn up to scanBatch quotes at a
+// time in key order, so no query holds a long-running cursor
+func (r *LatestOddsRepository) ScanOdds(ctx context.Context, fn func(batch []models.OddsUpdate) error) error {
+	cutoff := time.Now().UTC().Add(-r.ttl)
+	var lastEvent, lastBook string
+	for {
+		batch, read, err := r.scanPage(ctx, &lastEvent, &lastBook, cutoff)
+		if err != nil {
+			return err
+		}
+		if len(batch) > 0 {
+			if err := fn(batch); err != nil {
+				return err
+			}
+		}
+		if read < scanBatch {
+			return nil
+		}
+	}
+}
+
+// scanPage reads the scanBatch rows after the last key, moving it on, and
+// reports how many rows it read. Values that don't parse are skipped.
+func (r *LatestOddsRepository) scanPage(ctx context.Context, lastEvent, lastBook *string, cutoff time.Time) ([]models.OddsUpdate, int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT event_id, bookmaker, data FROM latest_odds
+		WHERE (event_id, bookmaker) > ($1, $2) AND saved_at > $3
+		ORDER BY event_id, bookmaker
+		LIMIT $4`,
+		*lastEvent, *lastBook, cutoff, scanBatch)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to scan odds: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []models.OddsUpdate
+	read := 0
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(lastEvent, lastBook, &data); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan odds: %w", err)
+		}
+		read++
+		var odd models.OddsUpdate
+		if err := json.Unmarshal(data, &odd); err != nil {
+			continue
+		}
+		batch = append(batch, odd)
+	}
+	return batch, read, rows.Err()
+}
@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// MemoryOddsStore is an in-process OddsStore, for tests and tools that
+// run without Redis
+type MemoryOddsStore struct {
+	mu     sync.RWMutex
+	ttl    time.Duration
+	events map[string]map[string]storedOdds // event ID, then bookmaker
+}
+
+type storedOdds struct {
+	odds    models.OddsUpdate
+	expires time.Time
+}
+
+// NewMemoryOddsStore creates an empty odds store
+func NewMemoryOddsStore(ttl time.Duration) *MemoryOddsStore {
+	return &MemoryOddsStore{ttl: ttl, events: make(map[string]map[string]storedOdds)}
+}
+
+// SaveOdds implements OddsStore
+func (s *MemoryOddsStore) SaveOdds(ctx context.Context, odds *models.OddsUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	books, ok := s.events[odds.EventID]
+	if !ok {
+		books = make(map[string]storedOdds)
+		s.events[odds.EventID] = books
+	}
+	books[odds.Bookmaker] = storedOdds{odds: *odds, expires: time.Now().Add(s.ttl)}
+	return nil
+}
+
+// EventOdds implements OddsStore. Expired quotes are dropped as they're found.
+func (s *MemoryOddsStore) EventOdds(ctx context.Context, eventID string) ([]models.OddsUpdate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.live(eventID, time.Now()), nil
+}
+
+// EventsOdds implements OddsStore
+func (s *MemoryOddsStore) EventsOdds(ctx context.Context, eventIDs []string) (map[string][]models.OddsUpdate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	odds := make(map[string][]models.OddsUpdate, len(eventIDs))
+	for _, eventID := range eventIDs {
+		if quotes := s.live(eventID, now); len(quotes) > 0 {
+			odds[eventID] = quotes
+		}
+	}
+	return odds, nil
+}
+
+// ScanOdds implements OddsStore, passing fn an event's quotes at a time.
+// fn runs without the lock held, so it may use the store.
+func (s *MemoryOddsStore) ScanOdds(ctx context.Context, fn func(batch []models.OddsUpdate) error) error {
+	s.mu.RLock()
+	eventIDs := make([]string, 0, len(s.events))
+	for eventID := range s.events {
+		eventIDs = append(eventIDs, eventID)
+	}
+	s.mu.RUnlock()
+
+	for _, eventID := range eventIDs {
+		s.mu.Lock()
+		batch := s.live(eventID, time.Now())
+		s.mu.Unlock()
+
+		if len(batch) == 0 {
+			continue
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// live returns an event's unexpired quotes, forgetting the rest. Caller
+// holds the write lock.
+func (s *MemoryOddsStore) live(eventID string, now time.Time) []models.OddsUpdate {
+	books := s.events[eventID]
+	odds := make([]models.OddsUpdate, 0, len(books))
+	for book, stored := range books {
+		if !now.Before(stored.expires) {
+			delete(books, book)
+			continue
+		}
+		odds = append(odds, stored.odds)
+	}
+	if len(books) == 0 {
+		delete(s.events, eventID)
+	}
+	return odds
+}
+
+// MemoryOpportunityStore is an in-process OpportunityStore, for tests and
+// tools that run without Redis
+type MemoryOpportunityStore struct {
+	mu            sync.Mutex
+	opportunities map[string]models.ArbitrageOpportunity
+}
+
+// NewMemoryOpportunityStore creates an empty opportunity store
+func NewMemoryOpportunityStore() *MemoryOpportunityStore {
+	return &MemoryOpportunityStore{opportunities: make(map[string]models.ArbitrageOpportunity)}
+}
+
+// SaveOpportunity implements OpportunityStore
+func (s *MemoryOpportunityStore) SaveOpportunity(ctx context.Context, arb *models.ArbitrageOpportunity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opportunities[arb.ID] = *arb
+	return nil
+}
+
+// RemoveOpportunity implements OpportunityStore
+func (s *MemoryOpportunityStore) RemoveOpportunity(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.opportunities, id)
+	return nil
+}
+
+// ActiveOpportunities implements OpportunityStore
+func (s *MemoryOpportunityStore) ActiveOpportunities(ctx context.Context, page Page) ([]models.ArbitrageOpportunity, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	opportunities := make([]models.ArbitrageOpportunity, 0, len(s.opportunities))
+	for _, arb := range s.opportunities {
+		if now.Before(arb.ExpiresAt) {
+			opportunities = append(opportunities, arb)
+		}
+	}
+	position := func(i int) Position {
+		return Position{ExpiresAt: opportunities[i].ExpiresAt, ID: opportunities[i].ID}
+	}
+	sort.Slice(opportunities, func(i, j int) bool {
+		return expiresBefore(position(i), position(j))
+	})
+
+	start := 0
+	if page.After != nil {
+		start = sort.Search(len(opportunities), func(i int) bool {
+			return expiresBefore(*page.After, position(i))
+		})
+	}
+	from, to := page.slice(start, len(opportunities))
+	return opportunities[from:to], len(opportunities), nil
+}
+
+// PruneOpportunities implements OpportunityStore
+func (s *MemoryOpportunityStore) PruneOpportunities(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	pruned := 0
+	for id, arb := range s.opportunities {
+		if !now.Before(arb.ExpiresAt) {
+			delete(s.opportunities, id)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// MemoryDetectorStateStore is an in-process DetectorStateStore, for tests
+// and tools that run a single detector without Redis
+type MemoryDetectorStateStore struct {
+	mu         sync.Mutex
+	params     map[string]map[string]string
+	partitions map[int]storedPartition
+}
+
+type storedPartition struct {
+	snapshots map[string][]byte
+	expires   time.Time
+}
+
+// NewMemoryDetectorStateStore creates an empty detector state store
+func NewMemoryDetectorStateStore() *MemoryDetectorStateStore {
+	return &MemoryDetectorStateStore{
+		params:     make(map[string]map[string]string),
+		partitions: make(map[int]storedPartition),
+	}
+}
+
+// SetParams replaces the params hash under key, as an operator would in Redis
+func (s *MemoryDetectorStateStore) SetParams(key string, fields map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := make(map[string]string, len(fields))
+	for field, value := range fields {
+		copied[field] = value
+	}
+	s.params[key] = copied
+}
+
+// Params implements DetectorStateStore
+func (s *MemoryDetectorStateStore) Params(ctx context.Context, key string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fields := make(map[string]string, len(s.params[key]))
+	for field, value := range s.params[key] {
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+// LoadPartition implements DetectorStateStore
+func (s *MemoryDetectorStateStore) LoadPartition(ctx context.Context, partition int) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.partitions[partition]
+	if !ok || !time.Now().Before(stored.expires) {
+		delete(s.partitions, partition)
+		return map[string][]byte{}, nil
+	}
+	snapshots := make(map[string][]byte, len(stored.snapshots))
+	for eventID, data := range stored.snapshots {
+		snapshots[eventID] = data
+	}
+	return snapshots, nil
+}
+
+// SavePartition implements DetectorStateStore
+func (s *MemoryDetectorStateStore) SavePartition(ctx context.Context, partition int, snapshots map[string][]byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(snapshots) == 0 {
+		delete(s.partitions, partition)
+		return nil
+	}
+	copied := make(map[string][]byte, len(snapshots))
+	for eventID, data := range snapshots {
+		copied[eventID] = append([]byte(nil), data...)
+	}
+	s.partitions[partition] = storedPartition{snapshots: copied, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// MemoryEventStore is an in-process EventStore, for tests and tools that
+// run without Postgres
+type MemoryEventStore struct {
+	mu     sync.Mutex
+	events map[string]models.Event
+}
+
+// NewMemoryEventStore creates an empty event store
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{events: make(map[string]models.Event)}
+}
+
+// UpsertEvent implements EventStore
+func (s *MemoryEventStore) UpsertEvent(ctx context.Context, ev *models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[ev.ID] = *ev
+	return nil
+}
+
+// ListEvents implements EventStore, in ID order
+func (s *MemoryEventStore) ListEvents(ctx context.Context) ([]models.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]models.Event, 0, len(s.events))
+	for _, ev := range s.events {
+		events = append(events, ev)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migration brings a database created by an older init.sql up to date.
+// init.sql always creates the latest schema, so every migration must also
+// be harmless on a database that already has it.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations run in order, each once. Append new ones; never edit one that
+// has shipped.
+var migrations = []migration{
+	{1, "arbitrage_history lifecycle columns", `
+		ALTER TABLE arbitrage_history
+			ADD COLUMN IF NOT EXISTS market_type VARCHAR(50) NOT NULL DEFAULT 'moneyline',
+			ADD COLUMN IF NOT EXISTS live BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS confidence DECIMAL(5, 4) NOT NULL DEFAULT 1,
+			ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP,
+			ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP,
+			ADD COLUMN IF NOT EXISTS close_reason VARCHAR(20),
+			ADD COLUMN IF NOT EXISTS lifetime_seconds DECIMAL(12, 3);
+		UPDATE arbitrage_history SET updated_at = created_at WHERE updated_at IS NULL;
+		ALTER TABLE arbitrage_history ALTER COLUMN updated_at SET NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_arbitrage_open ON arbitrage_history(expires_at) WHERE closed_at IS NULL;`,
+	},
+	{2, "partition odds_history by day", `
+		DO $$
+		DECLARE
+			day TIMESTAMP;
+		BEGIN
+			-- relkind 'p' is already partitioned
+			IF NOT EXISTS (SELECT 1 FROM pg_class WHERE relname = 'odds_history' AND relkind = 'r') THEN
+				RETURN;
+			END IF;
+
+			ALTER TABLE odds_history RENAME TO odds_history_unpartitioned;
+			ALTER INDEX IF EXISTS odds_history_pkey RENAME TO odds_history_unpartitioned_pkey;
+			ALTER SEQUENCE IF EXISTS odds_history_id_seq RENAME TO odds_history_unpartitioned_id_seq;
+			ALTER INDEX IF EXISTS idx_odds_event_timestamp RENAME TO idx_odds_event_timestamp_unpartitioned;
+			ALTER INDEX IF EXISTS idx_odds_bookmaker RENAME TO idx_odds_bookmaker_unpartitioned;
+
+			CREATE TABLE odds_history (
+				id BIGSERIAL,
+				event_id VARCHAR(255) NOT NULL,
+				bookmaker VARCHAR(100) NOT NULL,
+				home_odds DECIMAL(10, 3) NOT NULL,
+				away_odds DECIMAL(10, 3) NOT NULL,
+				draw_odds DECIMAL(10, 3),
+				market_type VARCHAR(50) NOT NULL,
+				timestamp TIMESTAMP NOT NULL,
+				PRIMARY KEY (id, timestamp)
+			) PARTITION BY RANGE (timestamp);
+			CREATE INDEX idx_odds_event_timestamp ON odds_history(event_id, timestamp DESC);
+			CREATE INDEX idx_odds_bookmaker ON odds_history(bookmaker);
+
+			-- Named like the recorder's, so the retention drops them in time
+			FOR day IN SELECT DISTINCT date_trunc('day', timestamp) FROM odds_history_unpartitioned LOOP
+				EXECUTE format('CREATE TABLE %I PARTITION OF odds_history FOR VALUES FROM (%L) TO (%L)',
+					'odds_history_' || to_char(day, 'YYYYMMDD'), day, day + INTERVAL '1 day');
+			END LOOP;
+
+			INSERT INTO odds_history (event_id, bookmaker, home_odds, away_odds, draw_odds, market_type, timestamp)
+			SELECT event_id, bookmaker, home_odds, away_odds, draw_odds, market_type, timestamp
+			FROM odds_history_unpartitioned;
+
+			DROP TABLE odds_history_unpartitioned;
+		END $$;`,
+	},
+	{3, "events end_time", `
+		ALTER TABLE events ADD COLUMN IF NOT EXISTS end_time TIMESTAMP;`,
+	},
+	{4, "latest_odds", `
+		CREATE TABLE IF NOT EXISTS latest_odds (
+			event_id VARCHAR(255) NOT NULL,
+			bookmaker VARCHAR(100) NOT NULL,
+			data JSONB NOT NULL,
+			saved_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (event_id, bookmaker)
+		);`,
+	},
+}
+
+// migrationLock is the advisory lock key serialising services that migrate
+// at the same time
+const migrationLock = 7283164
+
+// Migrate applies the migrations the database hasn't had, in one
+// transaction, and records them in schema_migrations
+func Migrate(ctx context.Context, db *sql.DB) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, m.sql); err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+		if _, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+			m.version, m.name); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migrations: %w", err)
+	}
+	return nil
+}
+
+// CheckSchema fails unless every migration has been applied, for services
+// that only read and leave migrating to the writers
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	var current int
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version, has a writer migrated the database yet: %w", err)
+	}
+	if latest := migrations[len(migrations)-1].version; current < latest {
+		return fmt.Errorf("database schema is at version %d, want %d", current, latest)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// partitionPrefix names odds_history's daily partitions, e.g.
+// odds_history_20240131
+const partitionPrefix = "odds_history_"
+
+// OddsHistoryRepository records odds ticks in the odds_history table,
+// which is partitioned by the day of the tick
+type OddsHistoryRepository struct {
+	db *sql.DB
+}
+
+// NewOddsHistoryRepository creates a repository on top of an open connection pool
+func NewOddsHistoryRepository(db *sql.DB) *OddsHistoryRepository {
+	return &OddsHistoryRepository{db: db}
+}
+
+// CopyTicks writes ticks with COPY, in one transaction. Every tick's day
+// must have a partition, see EnsurePartitions.
+func (r *OddsHistoryRepository) CopyTicks(ctx context.Context, ticks []models.OddsUpdate) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin copy: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("odds_history",
+		"event_id", "bookmaker", "home_odds", "away_odds", "draw_odds", "market_type", "timestamp"))
+	if err != nil {
+		return fmt.Errorf("failed to start copy: %w", err)
+	}
+	defer stmt.Close()
+
+	for i := range ticks {
+		t := &ticks[i]
+		var draw sql.NullFloat64
+		if t.DrawOdds != 0 {
+			draw = sql.NullFloat64{Float64: t.DrawOdds, Valid: true}
+		}
+		if _, err = stmt.ExecContext(ctx, t.EventID, t.Bookmaker, t.HomeOdds, t.AwayOdds, draw,
+			t.MarketType, t.Timestamp.UTC()); err != nil {
+			return fmt.Errorf("failed to copy tick: %w", err)
+		}
+	}
+
+	// An empty exec flushes the buffered rows
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to copy %d ticks: %w", len(ticks), err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit %d ticks: %w", len(ticks), err)
+	}
+	return nil
+}
+
+// EnsurePartitions creates the daily partitions covering from to to,
+// both days included
+func (r *OddsHistoryRepository) EnsurePartitions(ctx context.Context, from, to time.Time) error {
+	for day := truncateDay(from); !day.After(truncateDay(to)); day = day.AddDate(0, 0, 1) {
+		_, err := r.db.ExecContext(ctx, fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s PARTITION OF odds_history FOR VALUES FROM ('%s') TO ('%s')`,
+			partitionName(day), day.Format(time.DateOnly), day.AddDate(0, 0, 1).Format(time.DateOnly)))
+		if err != nil {
+			return fmt.Errorf("failed to create partition for %s: %w", day.Format(time.DateOnly), err)
+		}
+	}
+	return nil
+}
+
+// DropPartitionsBefore drops the daily partitions of days before cutoff's
+// and returns their names
+func (r *OddsHistoryRepository) DropPartitionsBefore(ctx context.Context, cutoff time.Time) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT child.relname
+		FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		WHERE parent.relname = 'odds_history'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+
+	var expired []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan partition: %w", err)
+		}
+		// Partitions not named by us are left alone
+		day, err := time.Parse("20060102", strings.TrimPrefix(name, partitionPrefix))
+		if err != nil || !strings.HasPrefix(name, partitionPrefix) {
+			continue
+		}
+		if day.Before(truncateDay(cutoff)) {
+			expired = append(expired, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+
+	var dropped []string
+	for _, name := range expired {
+		if _, err := r.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+pq.QuoteIdentifier(name)); err != nil {
+			return dropped, fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		dropped = append(dropped, name)
+	}
+	return dropped, nil
+}
+
+func partitionName(day time.Time) string {
+	return partitionPrefix + day.Format("20060102")
+}
+
+// truncateDay returns the start of t's day in UTC, the zone ticks are stored in
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq" // Postgres driver
+)
+
+// OpenPostgres opens a connection pool to Postgres. Connections are made
+// lazily, use startup.Postgres to wait for the database to come up.
+func OpenPostgres(url string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres: %w", err)
+	}
+
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(30 * time.Minute)
+
+	return db, nil
+}
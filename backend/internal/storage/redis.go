@@ -0,0 +1,409 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// activeOpportunitiesKey names the sorted set of open opportunity IDs,
+// scored by when they expire in Unix milliseconds
+const activeOpportunitiesKey = "active_arbitrage_by_expiry"
+
+// scanBatch is how many keys a SCAN step asks for and a pipeline reads
+const scanBatch = 500
+
+// eventOddsKey names the hash of an event's latest quotes, a field per book
+func eventOddsKey(eventID string) string {
+	return "event_odds:" + eventID
+}
+
+// eventsKey names the hash of the event catalogue, a field per event ID
+const eventsKey = "events"
+
+// opportunityKey names an open opportunity's latest state
+func opportunityKey(id string) string {
+	return fmt.Sprintf("arbitrage:%s", id)
+}
+
+// RedisOddsStore keeps an event's quotes in one hash, so the event is read
+// in a single HGETALL. The hash expires once no book has quoted for the
+// TTL; a book that stopped quoting sooner is dropped when its quote's
+// timestamp is older than the TTL.
+type RedisOddsStore struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+// NewRedisOddsStore creates an odds store on rdb
+func NewRedisOddsStore(rdb *redis.Client, ttl time.Duration) *RedisOddsStore {
+	return &RedisOddsStore{rdb: rdb, ttl: ttl}
+}
+
+// SaveOdds implements OddsStore
+func (s *RedisOddsStore) SaveOdds(ctx context.Context, odds *models.OddsUpdate) error {
+	data, err := json.Marshal(odds)
+	if err != nil {
+		return fmt.Errorf("failed to marshal odds: %w", err)
+	}
+
+	// Write the quote and push back the event's expiry together
+	key := eventOddsKey(odds.EventID)
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, odds.Bookmaker, data)
+		pipe.Expire(ctx, key, s.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save odds: %w", err)
+	}
+	return nil
+}
+
+// EventOdds implements OddsStore
+func (s *RedisOddsStore) EventOdds(ctx context.Context, eventID string) ([]models.OddsUpdate, error) {
+	odds, err := s.EventsOdds(ctx, []string{eventID})
+	if err != nil {
+		return nil, err
+	}
+	return odds[eventID], nil
+}
+
+// EventsOdds implements OddsStore, reading every event in one pipeline
+func (s *RedisOddsStore) EventsOdds(ctx context.Context, eventIDs []string) (map[string][]models.OddsUpdate, error) {
+	keys := make([]string, len(eventIDs))
+	for i, eventID := range eventIDs {
+		keys[i] = eventOddsKey(eventID)
+	}
+	quotes, err := s.load(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	odds := make(map[string][]models.OddsUpdate, len(eventIDs))
+	for i, eventID := range eventIDs {
+		if len(quotes[i]) > 0 {
+			odds[eventID] = quotes[i]
+		}
+	}
+	return odds, nil
+}
+
+// ScanOdds implements OddsStore, passing fn up to scanBatch events' quotes
+// at a time. It uses SCAN rather than KEYS, so Redis keeps serving
+// writers meanwhile.
+func (s *RedisOddsStore) ScanOdds(ctx context.Context, fn func(batch []models.OddsUpdate) error) error {
+	iter := s.rdb.Scan(ctx, 0, eventOddsKey("*"), scanBatch).Iterator()
+	keys := make([]string, 0, scanBatch)
+	flush := func() error {
+		quotes, err := s.load(ctx, keys)
+		keys = keys[:0]
+		if err != nil {
+			return err
+		}
+
+		var batch []models.OddsUpdate
+		for _, odds := range quotes {
+			batch = append(batch, odds...)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		return fn(batch)
+	}
+
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == scanBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan odds: %w", err)
+	}
+	return flush()
+}
+
+// load reads the events' hashes in one pipeline, returning each event's
+// current quotes in the order of keys. Values that don't parse and quotes
+// past the TTL are skipped; the latter are overwritten when their book
+// quotes again or go with the hash.
+func (s *RedisOddsStore) load(ctx context.Context, keys []string) ([][]models.OddsUpdate, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(keys))
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.HGetAll(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read odds: %w", err)
+	}
+
+	now := time.Now()
+	quotes := make([][]models.OddsUpdate, len(keys))
+	for i, cmd := range cmds {
+		books := cmd.Val()
+		odds := make([]models.OddsUpdate, 0, len(books))
+		for _, data := range books {
+			var odd models.OddsUpdate
+			if err := json.Unmarshal([]byte(data), &odd); err != nil {
+				continue
+			}
+			if now.Sub(odd.Timestamp) >= s.ttl {
+				continue
+			}
+			odds = append(odds, odd)
+		}
+		quotes[i] = odds
+	}
+
+	return quotes, nil
+}
+
+// detectorPartitionKey names the hash of a partition's event snapshots
+func detectorPartitionKey(partition int) string {
+	return fmt.Sprintf("detector:partition:%d", partition)
+}
+
+// RedisDetectorStateStore keeps the params in a hash an operator edits with
+// HSET, and each partition's snapshots in a hash, a field per event
+type RedisDetectorStateStore struct {
+	rdb *redis.Client
+}
+
+// NewRedisDetectorStateStore creates a detector state store on rdb
+func NewRedisDetectorStateStore(rdb *redis.Client) *RedisDetectorStateStore {
+	return &RedisDetectorStateStore{rdb: rdb}
+}
+
+// Params implements DetectorStateStore
+func (s *RedisDetectorStateStore) Params(ctx context.Context, key string) (map[string]string, error) {
+	fields, err := s.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read params: %w", err)
+	}
+	return fields, nil
+}
+
+// LoadPartition implements DetectorStateStore
+func (s *RedisDetectorStateStore) LoadPartition(ctx context.Context, partition int) (map[string][]byte, error) {
+	fields, err := s.rdb.HGetAll(ctx, detectorPartitionKey(partition)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load partition %d: %w", partition, err)
+	}
+	snapshots := make(map[string][]byte, len(fields))
+	for eventID, data := range fields {
+		snapshots[eventID] = []byte(data)
+	}
+	return snapshots, nil
+}
+
+// SavePartition implements DetectorStateStore in one round trip
+func (s *RedisDetectorStateStore) SavePartition(ctx context.Context, partition int, snapshots map[string][]byte, ttl time.Duration) error {
+	fields := make(map[string]interface{}, len(snapshots))
+	for eventID, data := range snapshots {
+		fields[eventID] = data
+	}
+
+	key := detectorPartitionKey(partition)
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(fields) > 0 {
+			pipe.HSet(ctx, key, fields)
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save partition %d: %w", partition, err)
+	}
+	return nil
+}
+
+// RedisOpportunityStore keeps each open opportunity under its own key,
+// expiring with the opportunity, and their IDs in a sorted set by expiry.
+// Reads take the unexpired IDs from the set, so an ID whose opportunity
+// expired is never read and is pruned later.
+type RedisOpportunityStore struct {
+	rdb *redis.Client
+}
+
+// NewRedisOpportunityStore creates an opportunity store on rdb
+func NewRedisOpportunityStore(rdb *redis.Client) *RedisOpportunityStore {
+	return &RedisOpportunityStore{rdb: rdb}
+}
+
+// expiryScore scores an opportunity in the active set
+func expiryScore(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// SaveOpportunity implements OpportunityStore
+func (s *RedisOpportunityStore) SaveOpportunity(ctx context.Context, arb *models.ArbitrageOpportunity) error {
+	data, err := json.Marshal(arb)
+	if err != nil {
+		return fmt.Errorf("failed to marshal arbitrage: %w", err)
+	}
+
+	// Store until the opportunity expires and index it by expiry in one
+	// round trip; both are safe to repeat, a requote moves the expiry
+	ttl := time.Until(arb.ExpiresAt)
+	if ttl <= 0 {
+		return s.RemoveOpportunity(ctx, arb.ID)
+	}
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, opportunityKey(arb.ID), data, ttl)
+		pipe.ZAdd(ctx, activeOpportunitiesKey, redis.Z{Score: float64(arb.ExpiresAt.UnixMilli()), Member: arb.ID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store arbitrage: %w", err)
+	}
+	return nil
+}
+
+// RemoveOpportunity implements OpportunityStore
+func (s *RedisOpportunityStore) RemoveOpportunity(ctx context.Context, id string) error {
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, activeOpportunitiesKey, id)
+		pipe.Del(ctx, opportunityKey(id))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove arbitrage: %w", err)
+	}
+	return nil
+}
+
+// ActiveOpportunities implements OpportunityStore in two round trips
+// whatever the page size: the page of IDs and the total, then one MGET.
+// Resuming after a position takes one more, for the IDs sharing its
+// score. An opportunity that expires in between is left out of the page.
+func (s *RedisOpportunityStore) ActiveOpportunities(ctx context.Context, page Page) ([]models.ArbitrageOpportunity, int, error) {
+	// Exclusive of now, as an opportunity expiring now is already gone
+	now := time.Now()
+	unexpired := &redis.ZRangeBy{Min: "(" + expiryScore(now), Max: "+inf", Offset: int64(max(page.Offset, 0))}
+
+	// Members with the same score are ordered by ID, so the page starts at
+	// the position's score, past the IDs up to its own
+	if after := page.After; after != nil && after.ExpiresAt.UnixMilli() > now.UnixMilli() {
+		score := expiryScore(after.ExpiresAt)
+		tied, err := s.rdb.ZRangeByScore(ctx, activeOpportunitiesKey, &redis.ZRangeBy{Min: score, Max: score}).Result()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to list active arbitrage: %w", err)
+		}
+		for _, id := range tied {
+			if id <= after.ID {
+				unexpired.Offset++
+			}
+		}
+		unexpired.Min = score
+	}
+	if page.Limit > 0 {
+		unexpired.Count = int64(page.Limit)
+	} else if unexpired.Offset > 0 {
+		unexpired.Count = -1
+	}
+
+	var ids *redis.StringSliceCmd
+	var total *redis.IntCmd
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		ids = pipe.ZRangeByScore(ctx, activeOpportunitiesKey, unexpired)
+		total = pipe.ZCount(ctx, activeOpportunitiesKey, "("+expiryScore(now), "+inf")
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list active arbitrage: %w", err)
+	}
+	if len(ids.Val()) == 0 {
+		return nil, int(total.Val()), nil
+	}
+
+	keys := make([]string, len(ids.Val()))
+	for i, id := range ids.Val() {
+		keys[i] = opportunityKey(id)
+	}
+	values, err := s.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read active arbitrage: %w", err)
+	}
+
+	opportunities := make([]models.ArbitrageOpportunity, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var arb models.ArbitrageOpportunity
+		if err := json.Unmarshal([]byte(data), &arb); err != nil {
+			continue
+		}
+		opportunities = append(opportunities, arb)
+	}
+	return opportunities, int(total.Val()), nil
+}
+
+// PruneOpportunities implements OpportunityStore. The opportunities'
+// own keys have expired already.
+func (s *RedisOpportunityStore) PruneOpportunities(ctx context.Context) (int, error) {
+	pruned, err := s.rdb.ZRemRangeByScore(ctx, activeOpportunitiesKey, "-inf", expiryScore(time.Now())).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune active arbitrage: %w", err)
+	}
+	return int(pruned), nil
+}
+
+// RedisEventStore keeps the event catalogue in one hash of JSON events
+type RedisEventStore struct {
+	rdb *redis.Client
+}
+
+// NewRedisEventStore creates an event store on rdb
+func NewRedisEventStore(rdb *redis.Client) *RedisEventStore {
+	return &RedisEventStore{rdb: rdb}
+}
+
+// UpsertEvent implements EventStore
+func (s *RedisEventStore) UpsertEvent(ctx context.Context, ev *models.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if err := s.rdb.HSet(ctx, eventsKey, ev.ID, data).Err(); err != nil {
+		return fmt.Errorf("failed to upsert event %s: %w", ev.ID, err)
+	}
+	return nil
+}
+
+// ListEvents implements EventStore, in ID order. Values that don't parse
+// are skipped.
+func (s *RedisEventStore) ListEvents(ctx context.Context) ([]models.Event, error) {
+	fields, err := s.rdb.HGetAll(ctx, eventsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	events := make([]models.Event, 0, len(fields))
+	for _, data := range fields {
+		var ev models.Event
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			continue
+		}
+		events = append(events, ev)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
@@ -0,0 +1,177 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+	"github.com/redis/go-redis/v9"
+)
+
+// saveExpiring saves an opportunity per expiry, in minutes from now, and
+// returns their positions by ID
+func saveExpiring(t *testing.T, store *storage.RedisOpportunityStore, minutes ...int) map[string]storage.Position {
+	t.Helper()
+	now := time.Now().UTC()
+	positions := make(map[string]storage.Position, len(minutes))
+	for _, m := range minutes {
+		arb := &models.ArbitrageOpportunity{
+			ID: "arb-" + strconv.Itoa(m), EventID: "event-" + strconv.Itoa(m), Status: models.OpportunityActive,
+			CreatedAt: now, UpdatedAt: now, ExpiresAt: now.Add(time.Duration(m) * time.Minute),
+		}
+		if err := store.SaveOpportunity(context.Background(), arb); err != nil {
+			t.Fatal(err)
+		}
+		positions[arb.ID] = storage.Position{ExpiresAt: arb.ExpiresAt, ID: arb.ID}
+	}
+	return positions
+}
+
+func TestRedisOpportunityPaging(t *testing.T) {
+	rdb, _ := newRedis(t)
+	store := storage.NewRedisOpportunityStore(rdb)
+	// Saved out of order; listed by expiry as arb-1 to arb-5
+	positions := saveExpiring(t, store, 3, 1, 5, 2, 4)
+	after := func(id string) *storage.Position {
+		position := positions[id]
+		return &position
+	}
+	expired := &storage.Position{ExpiresAt: time.Now().Add(-time.Minute), ID: "arb-0"}
+
+	tests := []struct {
+		name string
+		page storage.Page
+		want []string
+	}{
+		{"everything", storage.Page{}, []string{"arb-1", "arb-2", "arb-3", "arb-4", "arb-5"}},
+		{"first page", storage.Page{Limit: 2}, []string{"arb-1", "arb-2"}},
+		{"middle page", storage.Page{Offset: 2, Limit: 2}, []string{"arb-3", "arb-4"}},
+		{"short last page", storage.Page{Offset: 4, Limit: 2}, []string{"arb-5"}},
+		{"offset without limit", storage.Page{Offset: 3}, []string{"arb-4", "arb-5"}},
+		{"past the end", storage.Page{Offset: 5, Limit: 2}, nil},
+		{"negative offset", storage.Page{Offset: -1, Limit: 1}, []string{"arb-1"}},
+		{"after a position", storage.Page{After: after("arb-2"), Limit: 2}, []string{"arb-3", "arb-4"}},
+		{"after a position and an offset", storage.Page{After: after("arb-2"), Offset: 1}, []string{"arb-4", "arb-5"}},
+		{"after the last position", storage.Page{After: after("arb-5")}, nil},
+		{"after an expired position", storage.Page{After: expired, Limit: 1}, []string{"arb-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := store.ActiveOpportunities(context.Background(), tt.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 5 {
+				t.Errorf("total = %d, want 5", total)
+			}
+			if ids := opportunityIDs(got); fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("page = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisOpportunityPruning(t *testing.T) {
+	tests := []struct {
+		name       string
+		open       []int // minutes until each saved opportunity expires
+		orphaned   []int // minutes since each orphaned index entry expired
+		wantPruned int
+		wantActive []string
+	}{
+		{"nothing to prune", []int{1, 2}, nil, 0, []string{"arb-1", "arb-2"}},
+		{"orphans only", nil, []int{1, 60}, 2, nil},
+		{"orphans among open", []int{1, 2}, []int{1, 5}, 2, []string{"arb-1", "arb-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			rdb, _ := newRedis(t)
+			store := storage.NewRedisOpportunityStore(rdb)
+			saveExpiring(t, store, tt.open...)
+
+			// A detector that died leaves its index entries behind once
+			// the opportunities' own keys expire
+			for _, m := range tt.orphaned {
+				expired := time.Now().Add(-time.Duration(m) * time.Minute)
+				member := redis.Z{Score: float64(expired.UnixMilli()), Member: "orphan-" + strconv.Itoa(m)}
+				if err := rdb.ZAdd(ctx, "active_arbitrage_by_expiry", member).Err(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			pruned, err := store.PruneOpportunities(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pruned != tt.wantPruned {
+				t.Errorf("pruned %d, want %d", pruned, tt.wantPruned)
+			}
+
+			active, total, err := store.ActiveOpportunities(ctx, storage.Page{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := opportunityIDs(active); fmt.Sprint(ids) != fmt.Sprint(tt.wantActive) || total != len(tt.wantActive) {
+				t.Errorf("active = %v of %d, want %v", ids, total, tt.wantActive)
+			}
+			if left := rdb.ZCard(ctx, "active_arbitrage_by_expiry").Val(); int(left) != len(tt.open) {
+				t.Errorf("index holds %d entries, want %d", left, len(tt.open))
+			}
+		})
+	}
+}
+
+func TestRedisOddsExpiry(t *testing.T) {
+	const ttl = time.Minute
+
+	tests := []struct {
+		name      string
+		ages      map[string]time.Duration // quote age by book
+		elapsed   time.Duration            // time passed in Redis after saving
+		wantBooks int
+	}{
+		{"fresh quotes", map[string]time.Duration{"book-a": 0, "book-b": 10 * time.Second}, 0, 2},
+		{"a book stopped quoting", map[string]time.Duration{"book-a": 0, "book-b": 2 * ttl}, 0, 1},
+		{"every book stopped quoting", map[string]time.Duration{"book-a": 0}, ttl + time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			rdb, mr := newRedis(t)
+			store := storage.NewRedisOddsStore(rdb, ttl)
+
+			for book, age := range tt.ages {
+				odds := &models.OddsUpdate{EventID: "event", Bookmaker: book, HomeOdds: 2, AwayOdds: 2,
+					Timestamp: time.Now().Add(-age)}
+				if err := store.SaveOdds(ctx, odds); err != nil {
+					t.Fatal(err)
+				}
+			}
+			mr.FastForward(tt.elapsed)
+
+			got, err := store.EventOdds(ctx, "event")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.wantBooks {
+				t.Errorf("got %d quotes, want %d", len(got), tt.wantBooks)
+			}
+		})
+	}
+}
+
+func opportunityIDs(opportunities []models.ArbitrageOpportunity) []string {
+	var ids []string
+	for _, arb := range opportunities {
+		ids = append(ids, arb.ID)
+	}
+	return ids
+}
@@ -0,0 +1,598 @@
+// Package storagetest checks that a storage implementation behaves as the
+// interfaces in package storage promise. Every implementation must pass;
+// the tests in package storage run the checks against each of them.
+//
+// Checks use fresh random IDs, so they can run against a store holding
+// other data, and leave what they wrote behind.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/matthewhu/sportarbitrage/internal/models"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+)
+
+// checkTimeout bounds each check, so a store that hangs fails instead
+const checkTimeout = 30 * time.Second
+
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// run runs each check as a subtest of t
+func run(t *testing.T, checks []check) {
+	t.Helper()
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+			defer cancel()
+			if err := c.run(ctx); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// now is a time every store keeps exactly; Postgres keeps microseconds
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// OddsStore runs the OddsStore checks against store
+func OddsStore(t *testing.T, store storage.OddsStore) {
+	quote := func(eventID, book string, home, away float64) *models.OddsUpdate {
+		return &models.OddsUpdate{
+			ID: uuid.NewString(), EventID: eventID, Sport: "NBA", HomeTeam: "Home", AwayTeam: "Away",
+			Bookmaker: book, HomeOdds: home, AwayOdds: away, Timestamp: now(), MarketType: "moneyline",
+		}
+	}
+
+	run(t, []check{
+		{"odds are read back per book", func(ctx context.Context) error {
+			event := uuid.NewString()
+			a, b := quote(event, "book-a", 2.1, 1.9), quote(event, "book-b", 2.05, 1.95)
+			if err := saveOdds(ctx, store, a, b); err != nil {
+				return err
+			}
+			return expectOdds(ctx, store, event, a, b)
+		}},
+
+		{"a requote replaces the book's quote", func(ctx context.Context) error {
+			event := uuid.NewString()
+			a, b := quote(event, "book-a", 2.1, 1.9), quote(event, "book-b", 2.05, 1.95)
+			requote := quote(event, "book-a", 2.2, 1.8)
+			if err := saveOdds(ctx, store, a, b, requote); err != nil {
+				return err
+			}
+			return expectOdds(ctx, store, event, requote, b)
+		}},
+
+		{"events are kept apart", func(ctx context.Context) error {
+			event, other := uuid.NewString(), uuid.NewString()
+			a := quote(event, "book-a", 2.1, 1.9)
+			if err := saveOdds(ctx, store, a, quote(other, "book-b", 2.05, 1.95)); err != nil {
+				return err
+			}
+			if err := expectOdds(ctx, store, event, a); err != nil {
+				return err
+			}
+			return expectOdds(ctx, store, uuid.NewString())
+		}},
+
+		{"several events are read at once", func(ctx context.Context) error {
+			event, other, empty := uuid.NewString(), uuid.NewString(), uuid.NewString()
+			a, b := quote(event, "book-a", 2.1, 1.9), quote(event, "book-b", 2.05, 1.95)
+			c := quote(other, "book-a", 1.5, 2.6)
+			if err := saveOdds(ctx, store, a, b, c); err != nil {
+				return err
+			}
+
+			odds, err := store.EventsOdds(ctx, []string{event, other, empty})
+			if err != nil {
+				return fmt.Errorf("EventsOdds: %w", err)
+			}
+			if len(odds) != 2 {
+				return fmt.Errorf("got odds for %d events, want 2", len(odds))
+			}
+			if err := sameOdds(odds[event], a, b); err != nil {
+				return err
+			}
+			return sameOdds(odds[other], c)
+		}},
+
+		{"a scan sees every latest quote", func(ctx context.Context) error {
+			event := uuid.NewString()
+			a, b := quote(event, "book-a", 2.1, 1.9), quote(event, "book-b", 2.05, 1.95)
+			requote := quote(event, "book-b", 2.0, 2.0)
+			if err := saveOdds(ctx, store, a, b, requote); err != nil {
+				return err
+			}
+
+			var found []models.OddsUpdate
+			err := store.ScanOdds(ctx, func(batch []models.OddsUpdate) error {
+				for _, odds := range batch {
+					if odds.EventID == event {
+						found = append(found, odds)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("ScanOdds: %w", err)
+			}
+			return sameOdds(found, a, requote)
+		}},
+
+		{"a scan stops at fn's error", func(ctx context.Context) error {
+			if err := saveOdds(ctx, store, quote(uuid.NewString(), "book-a", 2.1, 1.9)); err != nil {
+				return err
+			}
+
+			stop := errors.New("stop")
+			calls := 0
+			err := store.ScanOdds(ctx, func([]models.OddsUpdate) error {
+				calls++
+				return stop
+			})
+			if !errors.Is(err, stop) {
+				return fmt.Errorf("ScanOdds returned %v, want fn's error", err)
+			}
+			if calls != 1 {
+				return fmt.Errorf("fn called %d times after failing, want 1", calls)
+			}
+			return nil
+		}},
+	})
+}
+
+func saveOdds(ctx context.Context, store storage.OddsStore, odds ...*models.OddsUpdate) error {
+	for _, o := range odds {
+		if err := store.SaveOdds(ctx, o); err != nil {
+			return fmt.Errorf("SaveOdds: %w", err)
+		}
+	}
+	return nil
+}
+
+func expectOdds(ctx context.Context, store storage.OddsStore, eventID string, want ...*models.OddsUpdate) error {
+	got, err := store.EventOdds(ctx, eventID)
+	if err != nil {
+		return fmt.Errorf("EventOdds: %w", err)
+	}
+	return sameOdds(got, want...)
+}
+
+// sameOdds compares quotes by book, in any order
+func sameOdds(got []models.OddsUpdate, want ...*models.OddsUpdate) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("got %d quotes, want %d", len(got), len(want))
+	}
+	byBook := make(map[string]models.OddsUpdate, len(got))
+	for _, o := range got {
+		byBook[o.Bookmaker] = o
+	}
+	for _, w := range want {
+		g, ok := byBook[w.Bookmaker]
+		if !ok {
+			return fmt.Errorf("no quote from %s", w.Bookmaker)
+		}
+		if g.ID != w.ID || g.EventID != w.EventID || g.HomeOdds != w.HomeOdds || g.AwayOdds != w.AwayOdds ||
+			g.MarketType != w.MarketType || !g.Timestamp.Equal(w.Timestamp) {
+			return fmt.Errorf("quote from %s is %+v, want %+v", w.Bookmaker, g, *w)
+		}
+	}
+	return nil
+}
+
+// OpportunityStore runs the OpportunityStore checks against store
+func OpportunityStore(t *testing.T, store storage.OpportunityStore) {
+	opportunity := func(profit float64) *models.ArbitrageOpportunity {
+		created := now()
+		return &models.ArbitrageOpportunity{
+			ID: uuid.NewString(), EventID: uuid.NewString(), Sport: "NBA", MarketType: "moneyline",
+			HomeTeam: "Home", AwayTeam: "Away", BookmakerHome: "book-a", BookmakerAway: "book-b",
+			HomeOdds: 2.1, AwayOdds: 2.05, ProfitPercent: profit,
+			HomeStake: 49.4, AwayStake: 50.6, TotalStake: 100, ExpectedReturn: 103.74,
+			Confidence: 0.9, Status: models.OpportunityActive, Event: models.OpportunityOpened,
+			CreatedAt: created, UpdatedAt: created, ExpiresAt: created.Add(time.Minute),
+		}
+	}
+	// updated is a later state of arb
+	updated := func(arb *models.ArbitrageOpportunity, profit float64) *models.ArbitrageOpportunity {
+		next := *arb
+		next.ProfitPercent = profit
+		next.Event = models.OpportunityUpdated
+		next.UpdatedAt = arb.UpdatedAt.Add(time.Second)
+		return &next
+	}
+
+	run(t, []check{
+		{"a saved opportunity is active", func(ctx context.Context) error {
+			arb := opportunity(3.74)
+			if err := store.SaveOpportunity(ctx, arb); err != nil {
+				return fmt.Errorf("SaveOpportunity: %w", err)
+			}
+			return expectActive(ctx, store, arb)
+		}},
+
+		{"saving again replaces the state", func(ctx context.Context) error {
+			arb := opportunity(3.74)
+			next := updated(arb, 2.5)
+			for _, state := range []*models.ArbitrageOpportunity{arb, next} {
+				if err := store.SaveOpportunity(ctx, state); err != nil {
+					return fmt.Errorf("SaveOpportunity: %w", err)
+				}
+			}
+			return expectActive(ctx, store, next)
+		}},
+
+		{"a removed opportunity isn't active", func(ctx context.Context) error {
+			arb := opportunity(3.74)
+			if err := store.SaveOpportunity(ctx, arb); err != nil {
+				return fmt.Errorf("SaveOpportunity: %w", err)
+			}
+			if err := store.RemoveOpportunity(ctx, arb.ID); err != nil {
+				return fmt.Errorf("RemoveOpportunity: %w", err)
+			}
+			if err := expectInactive(ctx, store, arb.ID); err != nil {
+				return err
+			}
+			// Removing twice, or something never saved, is fine
+			if err := store.RemoveOpportunity(ctx, arb.ID); err != nil {
+				return fmt.Errorf("RemoveOpportunity again: %w", err)
+			}
+			if err := store.RemoveOpportunity(ctx, uuid.NewString()); err != nil {
+				return fmt.Errorf("RemoveOpportunity of an unknown ID: %w", err)
+			}
+			return nil
+		}},
+
+		{"saving a removed opportunity reopens it", func(ctx context.Context) error {
+			arb := opportunity(3.74)
+			if err := store.SaveOpportunity(ctx, arb); err != nil {
+				return fmt.Errorf("SaveOpportunity: %w", err)
+			}
+			if err := store.RemoveOpportunity(ctx, arb.ID); err != nil {
+				return fmt.Errorf("RemoveOpportunity: %w", err)
+			}
+			reopened := updated(arb, 1.5)
+			if err := store.SaveOpportunity(ctx, reopened); err != nil {
+				return fmt.Errorf("SaveOpportunity: %w", err)
+			}
+			return expectActive(ctx, store, reopened)
+		}},
+
+		{"an expired opportunity isn't active", func(ctx context.Context) error {
+			arb := opportunity(3.74)
+			arb.CreatedAt = arb.CreatedAt.Add(-2 * time.Minute)
+			arb.UpdatedAt = arb.CreatedAt
+			arb.ExpiresAt = arb.CreatedAt.Add(time.Minute)
+			if err := store.SaveOpportunity(ctx, arb); err != nil {
+				return fmt.Errorf("SaveOpportunity: %w", err)
+			}
+			return expectInactive(ctx, store, arb.ID)
+		}},
+
+		{"active opportunities are ordered by expiry and paged", func(ctx context.Context) error {
+			// Saved latest expiry first
+			for i := 3; i > 0; i-- {
+				arb := opportunity(3.74)
+				arb.ExpiresAt = arb.CreatedAt.Add(time.Duration(i) * time.Minute)
+				if err := store.SaveOpportunity(ctx, arb); err != nil {
+					return fmt.Errorf("SaveOpportunity: %w", err)
+				}
+			}
+
+			all, total, err := store.ActiveOpportunities(ctx, storage.Page{})
+			if err != nil {
+				return fmt.Errorf("ActiveOpportunities: %w", err)
+			}
+			if total != len(all) || total < 3 {
+				return fmt.Errorf("listed %d opportunities of %d, want all and at least 3", len(all), total)
+			}
+			for i := 1; i < len(all); i++ {
+				if all[i].ExpiresAt.Before(all[i-1].ExpiresAt) {
+					return fmt.Errorf("opportunity %d expires before the one listed ahead of it", i)
+				}
+			}
+
+			page, pageTotal, err := store.ActiveOpportunities(ctx, storage.Page{Offset: 1, Limit: 2})
+			if err != nil {
+				return fmt.Errorf("ActiveOpportunities: %w", err)
+			}
+			if pageTotal != total || len(page) != 2 || page[0].ID != all[1].ID || page[1].ID != all[2].ID {
+				return fmt.Errorf("page at offset 1 of 2 doesn't match the full listing")
+			}
+
+			tail, _, err := store.ActiveOpportunities(ctx, storage.Page{Offset: total - 1})
+			if err != nil {
+				return fmt.Errorf("ActiveOpportunities: %w", err)
+			}
+			if len(tail) != 1 || tail[0].ID != all[total-1].ID {
+				return fmt.Errorf("page from the last offset has %d opportunities, want the last one", len(tail))
+			}
+			return nil
+		}},
+
+		{"a page resumes after a position", func(ctx context.Context) error {
+			// Two share an expiry, so the IDs break the tie
+			first, tied, last := opportunity(3.74), opportunity(3.74), opportunity(3.74)
+			tied.ExpiresAt = first.ExpiresAt
+			last.ExpiresAt = first.ExpiresAt.Add(time.Second)
+			for _, arb := range []*models.ArbitrageOpportunity{first, tied, last} {
+				if err := store.SaveOpportunity(ctx, arb); err != nil {
+					return fmt.Errorf("SaveOpportunity: %w", err)
+				}
+			}
+
+			all, _, err := store.ActiveOpportunities(ctx, storage.Page{})
+			if err != nil {
+				return fmt.Errorf("ActiveOpportunities: %w", err)
+			}
+			for i := range all {
+				at := storage.Position{ExpiresAt: all[i].ExpiresAt, ID: all[i].ID}
+				page, total, err := store.ActiveOpportunities(ctx, storage.Page{After: &at, Limit: 2})
+				if err != nil {
+					return fmt.Errorf("ActiveOpportunities: %w", err)
+				}
+				want := all[i+1 : min(i+3, len(all))]
+				if total != len(all) || len(page) != len(want) {
+					return fmt.Errorf("page after %d has %d of %d opportunities, want %d of %d",
+						i, len(page), total, len(want), len(all))
+				}
+				for j := range want {
+					if page[j].ID != want[j].ID {
+						return fmt.Errorf("page after %d doesn't match the full listing", i)
+					}
+				}
+			}
+
+			// A removed opportunity's position still works
+			if err := store.RemoveOpportunity(ctx, tied.ID); err != nil {
+				return fmt.Errorf("RemoveOpportunity: %w", err)
+			}
+			at := storage.Position{ExpiresAt: tied.ExpiresAt, ID: tied.ID}
+			page, _, err := store.ActiveOpportunities(ctx, storage.Page{After: &at})
+			if err != nil {
+				return fmt.Errorf("ActiveOpportunities: %w", err)
+			}
+			for _, arb := range page {
+				if arb.ID == tied.ID || (arb.ID == first.ID && first.ID < tied.ID) {
+					return fmt.Errorf("page after a removed opportunity repeats %s", arb.ID)
+				}
+			}
+			for _, arb := range page {
+				if arb.ID == last.ID {
+					return nil
+				}
+			}
+			return fmt.Errorf("page after a removed opportunity misses the one after it")
+		}},
+
+		{"pruning leaves only unexpired opportunities", func(ctx context.Context) error {
+			expiring, open := opportunity(3.74), opportunity(2.5)
+			expiring.ExpiresAt = expiring.CreatedAt.Add(100 * time.Millisecond)
+			for _, arb := range []*models.ArbitrageOpportunity{expiring, open} {
+				if err := store.SaveOpportunity(ctx, arb); err != nil {
+					return fmt.Errorf("SaveOpportunity: %w", err)
+				}
+			}
+			time.Sleep(time.Until(expiring.ExpiresAt) + 50*time.Millisecond)
+
+			if _, err := store.PruneOpportunities(ctx); err != nil {
+				return fmt.Errorf("PruneOpportunities: %w", err)
+			}
+			if err := expectInactive(ctx, store, expiring.ID); err != nil {
+				return err
+			}
+			return expectActive(ctx, store, open)
+		}},
+	})
+}
+
+// findActive returns the active opportunities with the given ID
+func findActive(ctx context.Context, store storage.OpportunityStore, id string) ([]models.ArbitrageOpportunity, error) {
+	active, _, err := store.ActiveOpportunities(ctx, storage.Page{})
+	if err != nil {
+		return nil, fmt.Errorf("ActiveOpportunities: %w", err)
+	}
+	var found []models.ArbitrageOpportunity
+	for _, arb := range active {
+		if arb.ID == id {
+			found = append(found, arb)
+		}
+	}
+	return found, nil
+}
+
+func expectActive(ctx context.Context, store storage.OpportunityStore, want *models.ArbitrageOpportunity) error {
+	found, err := findActive(ctx, store, want.ID)
+	if err != nil {
+		return err
+	}
+	if len(found) != 1 {
+		return fmt.Errorf("opportunity listed %d times, want once", len(found))
+	}
+	g := found[0]
+	if g.EventID != want.EventID || g.BookmakerHome != want.BookmakerHome || g.BookmakerAway != want.BookmakerAway ||
+		g.HomeOdds != want.HomeOdds || g.AwayOdds != want.AwayOdds || g.ProfitPercent != want.ProfitPercent ||
+		g.TotalStake != want.TotalStake || g.Status != want.Status ||
+		!g.UpdatedAt.Equal(want.UpdatedAt) || !g.ExpiresAt.Equal(want.ExpiresAt) {
+		return fmt.Errorf("opportunity is %+v, want %+v", g, *want)
+	}
+	return nil
+}
+
+func expectInactive(ctx context.Context, store storage.OpportunityStore, id string) error {
+	found, err := findActive(ctx, store, id)
+	if err != nil {
+		return err
+	}
+	if len(found) != 0 {
+		return fmt.Errorf("opportunity still active")
+	}
+	return nil
+}
+
+// EventStore runs the EventStore checks against store
+func EventStore(t *testing.T, store storage.EventStore) {
+	event := func() *models.Event {
+		return &models.Event{
+			ID: uuid.NewString(), Sport: "NBA", League: "NBA", HomeTeam: "Home", AwayTeam: "Away",
+			StartTime: now().Add(time.Hour), Status: models.EventStatusUpcoming,
+		}
+	}
+
+	run(t, []check{
+		{"an upserted event is listed", func(ctx context.Context) error {
+			ev := event()
+			if err := store.UpsertEvent(ctx, ev); err != nil {
+				return fmt.Errorf("UpsertEvent: %w", err)
+			}
+			return expectEvent(ctx, store, ev)
+		}},
+
+		{"upserting again replaces the event", func(ctx context.Context) error {
+			ev := event()
+			if err := store.UpsertEvent(ctx, ev); err != nil {
+				return fmt.Errorf("UpsertEvent: %w", err)
+			}
+			next := *ev
+			next.Status = models.EventStatusLive
+			next.StartTime = ev.StartTime.Add(-30 * time.Minute)
+			if err := store.UpsertEvent(ctx, &next); err != nil {
+				return fmt.Errorf("UpsertEvent: %w", err)
+			}
+			return expectEvent(ctx, store, &next)
+		}},
+	})
+}
+
+func expectEvent(ctx context.Context, store storage.EventStore, want *models.Event) error {
+	events, err := store.ListEvents(ctx)
+	if err != nil {
+		return fmt.Errorf("ListEvents: %w", err)
+	}
+	var found []models.Event
+	for _, ev := range events {
+		if ev.ID == want.ID {
+			found = append(found, ev)
+		}
+	}
+	if len(found) != 1 {
+		return fmt.Errorf("event listed %d times, want once", len(found))
+	}
+	g := found[0]
+	if g.Sport != want.Sport || g.League != want.League || g.HomeTeam != want.HomeTeam ||
+		g.AwayTeam != want.AwayTeam || g.Status != want.Status || !g.StartTime.Equal(want.StartTime) {
+		return fmt.Errorf("event is %+v, want %+v", g, *want)
+	}
+	return nil
+}
+
+// DetectorStateStore runs the DetectorStateStore checks against store.
+// setParams writes a params hash the way an operator would.
+func DetectorStateStore(t *testing.T, store storage.DetectorStateStore, setParams func(ctx context.Context, key string, fields map[string]string) error) {
+	// Partitions past any real topic's, so the checks don't meet live state
+	partition := func() int {
+		return 1_000_000 + rand.Intn(1_000_000_000)
+	}
+
+	run(t, []check{
+		{"params are read back", func(ctx context.Context) error {
+			key := "params:" + uuid.NewString()
+			want := map[string]string{"min_profit_percent": "1.5", "stake": "200"}
+			if err := setParams(ctx, key, want); err != nil {
+				return fmt.Errorf("setting params: %w", err)
+			}
+			got, err := store.Params(ctx, key)
+			if err != nil {
+				return fmt.Errorf("Params: %w", err)
+			}
+			return sameFields(got, want)
+		}},
+
+		{"missing params are empty", func(ctx context.Context) error {
+			got, err := store.Params(ctx, "params:"+uuid.NewString())
+			if err != nil {
+				return fmt.Errorf("Params: %w", err)
+			}
+			if len(got) != 0 {
+				return fmt.Errorf("got %d params, want none", len(got))
+			}
+			return nil
+		}},
+
+		{"a saved partition is loaded back", func(ctx context.Context) error {
+			p := partition()
+			want := map[string][]byte{uuid.NewString(): []byte(`{"quotes":[]}`), uuid.NewString(): []byte(`{}`)}
+			if err := store.SavePartition(ctx, p, want, time.Minute); err != nil {
+				return fmt.Errorf("SavePartition: %w", err)
+			}
+			return expectPartition(ctx, store, p, want)
+		}},
+
+		{"saving replaces the partition", func(ctx context.Context) error {
+			p := partition()
+			first := map[string][]byte{uuid.NewString(): []byte(`{}`)}
+			second := map[string][]byte{uuid.NewString(): []byte(`{"dropped":true}`)}
+			for _, snapshots := range []map[string][]byte{first, second} {
+				if err := store.SavePartition(ctx, p, snapshots, time.Minute); err != nil {
+					return fmt.Errorf("SavePartition: %w", err)
+				}
+			}
+			return expectPartition(ctx, store, p, second)
+		}},
+
+		{"saving nothing clears the partition", func(ctx context.Context) error {
+			p := partition()
+			if err := store.SavePartition(ctx, p, map[string][]byte{uuid.NewString(): []byte(`{}`)}, time.Minute); err != nil {
+				return fmt.Errorf("SavePartition: %w", err)
+			}
+			if err := store.SavePartition(ctx, p, nil, time.Minute); err != nil {
+				return fmt.Errorf("SavePartition: %w", err)
+			}
+			return expectPartition(ctx, store, p, nil)
+		}},
+
+		{"an unknown partition is empty", func(ctx context.Context) error {
+			return expectPartition(ctx, store, partition(), nil)
+		}},
+	})
+}
+
+func expectPartition(ctx context.Context, store storage.DetectorStateStore, partition int, want map[string][]byte) error {
+	got, err := store.LoadPartition(ctx, partition)
+	if err != nil {
+		return fmt.Errorf("LoadPartition: %w", err)
+	}
+	if len(got) != len(want) {
+		return fmt.Errorf("loaded %d snapshots, want %d", len(got), len(want))
+	}
+	for eventID, data := range want {
+		if string(got[eventID]) != string(data) {
+			return fmt.Errorf("snapshot of %s is %q, want %q", eventID, got[eventID], data)
+		}
+	}
+	return nil
+}
+
+func sameFields(got, want map[string]string) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("got %d fields, want %d", len(got), len(want))
+	}
+	for field, value := range want {
+		if got[field] != value {
+			return fmt.Errorf("field %s is %q, want %q", field, got[field], value)
+		}
+	}
+	return nil
+}
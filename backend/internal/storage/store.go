@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/matthewhu/sportarbitrage/internal/models"
+)
+
+// OddsStore holds the latest quote of every book for every event, for
+// lookups and for warming a detector's cache
+type OddsStore interface {
+	// SaveOdds stores a book's quote for an event, replacing its last one.
+	// Quotes not refreshed within the store's TTL are forgotten.
+	SaveOdds(ctx context.Context, odds *models.OddsUpdate) error
+
+	// EventOdds returns the quotes stored for an event, one per book
+	EventOdds(ctx context.Context, eventID string) ([]models.OddsUpdate, error)
+
+	// EventsOdds returns the quotes stored for several events at once, by
+	// event ID. Events without quotes are left out.
+	EventsOdds(ctx context.Context, eventIDs []string) (map[string][]models.OddsUpdate, error)
+
+	// ScanOdds calls fn with every stored quote, a batch at a time. An
+	// error from fn stops the scan and is returned.
+	ScanOdds(ctx context.Context, fn func(batch []models.OddsUpdate) error) error
+}
+
+// OpportunityStore holds the open arbitrage opportunities until they close
+// or expire
+type OpportunityStore interface {
+	// SaveOpportunity stores an opportunity's latest state, opening it if
+	// it isn't open
+	SaveOpportunity(ctx context.Context, arb *models.ArbitrageOpportunity) error
+
+	// RemoveOpportunity closes an opportunity. Unknown IDs are ignored.
+	RemoveOpportunity(ctx context.Context, id string) error
+
+	// ActiveOpportunities returns a page of the open opportunities that
+	// haven't expired, the soonest to expire first, and how many there
+	// are in all. Expiries are compared to the millisecond, ties broken
+	// by ID, so every opportunity has a fixed place a Page can resume at.
+	ActiveOpportunities(ctx context.Context, page Page) ([]models.ArbitrageOpportunity, int, error)
+
+	// PruneOpportunities forgets opportunities that expired without being
+	// removed, e.g. because their detector died, and reports how many
+	PruneOpportunities(ctx context.Context) (int, error)
+}
+
+// Page selects part of a listing. The zero Page selects all of it.
+type Page struct {
+	After  *Position // start past this place; nil for the beginning
+	Offset int       // then skip this many
+	Limit  int       // 0 for no limit
+}
+
+// Position is the place of an opportunity in a listing, for a page to
+// resume after it whether or not the opportunity is still open
+type Position struct {
+	ExpiresAt time.Time
+	ID        string
+}
+
+// slice returns the page's part of n items as slice bounds, counting the
+// offset from start
+func (p Page) slice(start, n int) (from, to int) {
+	from = min(start+max(p.Offset, 0), n)
+	to = n
+	if p.Limit > 0 {
+		to = min(from+p.Limit, n)
+	}
+	return from, to
+}
+
+// expiresBefore reports whether opportunity a comes before b in a listing
+func expiresBefore(a, b Position) bool {
+	if am, bm := a.ExpiresAt.UnixMilli(), b.ExpiresAt.UnixMilli(); am != bm {
+		return am < bm
+	}
+	return a.ID < b.ID
+}
+
+// DetectorStateStore holds what detector replicas share: the runtime params
+// and the event state handed over with a partition when the group rebalances
+type DetectorStateStore interface {
+	// Params returns the fields of the params hash stored under key, empty
+	// if there is none
+	Params(ctx context.Context, key string) (map[string]string, error)
+
+	// LoadPartition returns the snapshots last saved for a partition, by
+	// event ID, empty if there are none
+	LoadPartition(ctx context.Context, partition int) (map[string][]byte, error)
+
+	// SavePartition replaces a partition's snapshots, keeping them for ttl
+	SavePartition(ctx context.Context, partition int, snapshots map[string][]byte, ttl time.Duration) error
+}
+
+// EventStore holds the event catalogue
+type EventStore interface {
+	// UpsertEvent inserts an event or refreshes its schedule and status
+	UpsertEvent(ctx context.Context, ev *models.Event) error
+
+	// ListEvents returns every event in the catalogue
+	ListEvents(ctx context.Context) ([]models.Event, error)
+}
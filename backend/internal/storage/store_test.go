@@ -0,0 +1,93 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/matthewhu/sportarbitrage/internal/storage"
+	"github.com/matthewhu/sportarbitrage/internal/storage/storagetest"
+	"github.com/redis/go-redis/v9"
+)
+
+// postgresEnv names the variable holding the URL of a scratch database
+// created from init.sql; the Postgres tests skip without it
+const postgresEnv = "STORAGE_TEST_POSTGRES"
+
+func TestMemoryStores(t *testing.T) {
+	t.Run("odds", func(t *testing.T) {
+		storagetest.OddsStore(t, storage.NewMemoryOddsStore(time.Minute))
+	})
+	t.Run("opportunities", func(t *testing.T) {
+		storagetest.OpportunityStore(t, storage.NewMemoryOpportunityStore())
+	})
+	t.Run("events", func(t *testing.T) {
+		storagetest.EventStore(t, storage.NewMemoryEventStore())
+	})
+	t.Run("detector state", func(t *testing.T) {
+		state := storage.NewMemoryDetectorStateStore()
+		storagetest.DetectorStateStore(t, state, func(ctx context.Context, key string, fields map[string]string) error {
+			state.SetParams(key, fields)
+			return nil
+		})
+	})
+}
+
+// newRedis returns a client on an embedded Redis closed with the test
+func newRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb, mr
+}
+
+func TestRedisStores(t *testing.T) {
+	rdb, _ := newRedis(t)
+
+	t.Run("odds", func(t *testing.T) {
+		storagetest.OddsStore(t, storage.NewRedisOddsStore(rdb, time.Minute))
+	})
+	t.Run("opportunities", func(t *testing.T) {
+		storagetest.OpportunityStore(t, storage.NewRedisOpportunityStore(rdb))
+	})
+	t.Run("events", func(t *testing.T) {
+		storagetest.EventStore(t, storage.NewRedisEventStore(rdb))
+	})
+	t.Run("detector state", func(t *testing.T) {
+		storagetest.DetectorStateStore(t, storage.NewRedisDetectorStateStore(rdb), func(ctx context.Context, key string, fields map[string]string) error {
+			return rdb.HSet(ctx, key, fields).Err()
+		})
+	})
+}
+
+func TestPostgresStores(t *testing.T) {
+	url := os.Getenv(postgresEnv)
+	if url == "" {
+		t.Skipf("%s not set", postgresEnv)
+	}
+
+	db, err := storage.OpenPostgres(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("odds", func(t *testing.T) {
+		storagetest.OddsStore(t, storage.NewLatestOddsRepository(db, time.Minute))
+	})
+	t.Run("opportunities", func(t *testing.T) {
+		storagetest.OpportunityStore(t, storage.NewHistoryRepository(db))
+	})
+	t.Run("events", func(t *testing.T) {
+		storagetest.EventStore(t, storage.NewEventRepository(db))
+	})
+}
@@ -0,0 +1,149 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/matthewhu/sportarbitrage/internal/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LoggingOptions select the log level and output format
+type LoggingOptions struct {
+	Level  string // debug, info, warn or error
+	Format string // json or text
+}
+
+// LoggingOptionsFrom converts the logging settings of the config
+func LoggingOptionsFrom(c config.LoggingConfig) LoggingOptions {
+	return LoggingOptions{
+		Level:  c.Level,
+		Format: c.Format,
+	}
+}
+
+// level is shared by every logger, so changing it takes effect everywhere
+var level = new(slog.LevelVar)
+
+// SetupLogging installs the default structured logger for service. Every
+// line carries the service and instance, and lines logged with a context
+// carry the trace ID of the span in it.
+func SetupLogging(cfg LoggingOptions, service, instance string) error {
+	lvl, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	level.Set(lvl)
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch cfg.Format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	logger := slog.New(traceHandler{handler}).With("service", service, "instance", instance)
+	slog.SetDefault(logger)
+	return nil
+}
+
+// ParseLevel converts a level name such as "debug" to its slog level
+func ParseLevel(name string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+	return lvl, nil
+}
+
+// Fatal logs msg at error level and exits
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// LevelHandler reports the log level on GET and changes it on PUT or POST,
+// e.g. curl -X PUT localhost:8081/admin/log-level -d '{"level":"debug"}'
+func LevelHandler() http.Handler {
+	type body struct {
+		Level string `json:"level"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var req body
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+				return
+			}
+			lvl, err := ParseLevel(req.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if lvl != level.Level() {
+				slog.Info("Log level changed", "from", level.Level().String(), "to", lvl.String())
+				level.Set(lvl)
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body{Level: strings.ToLower(level.Level().String())})
+	})
+}
+
+// Sampler lets one in every n calls through, for lines too frequent to log
+// each time
+type Sampler struct {
+	n     uint64
+	count atomic.Uint64
+}
+
+// NewSampler creates a sampler passing one in n calls; n below 2 passes all
+func NewSampler(n int) *Sampler {
+	if n < 1 {
+		n = 1
+	}
+	return &Sampler{n: uint64(n)}
+}
+
+// Allow reports whether this call is sampled
+func (s *Sampler) Allow() bool {
+	return s.count.Add(1)%s.n == 1%s.n
+}
+
+// traceHandler adds the trace ID of the span in the record's context
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
@@ -26,8 +26,11 @@ function App() {
           const newOpportunity = data.data as ArbitrageOpportunity;
           
           setOpportunities(prev => {
-            // Remove duplicates and add new opportunity
+            // Replace the opportunity's previous state, or drop it once closed
             const filtered = prev.filter(opp => opp.id !== newOpportunity.id);
+            if (newOpportunity.event === 'closed') {
+              return filtered;
+            }
             return [newOpportunity, ...filtered].slice(0, 50); // Keep last 50
           });
         }
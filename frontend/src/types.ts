@@ -16,6 +16,13 @@ export interface ArbitrageOpportunity {
   created_at: string;
   expires_at: string;
   status: 'active' | 'expired' | 'executed';
+  live: boolean;
+  confidence: number;
+  market_type: string;
+  event: 'opened' | 'updated' | 'closed';
+  updated_at: string;
+  close_reason?: 'prices_moved' | 'stale' | 'expired' | 'event_live' | 'event_ended';
+  lifetime_seconds?: number;
 }
 
 export interface OddsUpdate {